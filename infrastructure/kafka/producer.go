@@ -13,6 +13,10 @@ var (
 	ErrAsyncProducer = errors.New("creating new async Kafka producer failed")
 	// ErrCloseProducer is an error when async producer wasn't closed properly.
 	ErrCloseProducer = errors.New("can't close async producer properly")
+	// ErrSyncProducer is an error when Kafka sync producer wasn't opened.
+	ErrSyncProducer = errors.New("creating new sync Kafka producer failed")
+	// ErrSendMessage is an error when a message wasn't acknowledged by Kafka.
+	ErrSendMessage = errors.New("sending message to Kafka failed")
 )
 
 // AsyncProducer is a Kafka async producer.
@@ -70,3 +74,55 @@ func (k *AsyncProducer) Close() error {
 	}
 	return nil
 }
+
+// SyncProducer is a Kafka sync producer, it waits for every message to be acknowledged.
+type SyncProducer struct {
+	Config   *Config
+	producer sarama.SyncProducer
+}
+
+// NewSyncProducer creates a new Kafka sync producer.
+func NewSyncProducer(
+	config *Config,
+	partitioner sarama.PartitionerConstructor,
+	acks sarama.RequiredAcks,
+) (*SyncProducer, error) {
+	cfg := sarama.NewConfig()
+
+	cfg.Producer.Partitioner = partitioner
+	cfg.Producer.RequiredAcks = acks
+
+	cfg.Producer.Return.Successes = true
+	cfg.Producer.Return.Errors = true
+
+	brokers := make([]string, len(config.Brokers))
+	for idx, broker := range config.Brokers {
+		brokers[idx] = net.JoinHostPort(broker.Host, strconv.Itoa(broker.Port))
+	}
+
+	syncProducer, err := sarama.NewSyncProducer(brokers, cfg)
+	if err != nil {
+		return nil, errors.Join(ErrSyncProducer, err)
+	}
+
+	return &SyncProducer{
+		Config:   config,
+		producer: syncProducer,
+	}, nil
+}
+
+// SendMessage sends a message to Kafka and waits for it to be acknowledged.
+func (k *SyncProducer) SendMessage(message *sarama.ProducerMessage) error {
+	if _, _, err := k.producer.SendMessage(message); err != nil {
+		return errors.Join(ErrSendMessage, err)
+	}
+	return nil
+}
+
+// Close closes the Kafka sync producer.
+func (k *SyncProducer) Close() error {
+	if err := k.producer.Close(); err != nil {
+		return errors.Join(ErrCloseProducer, err)
+	}
+	return nil
+}
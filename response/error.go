@@ -6,7 +6,7 @@ import (
 
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
-	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/yogenyslav/pkg/storage/postgres/pgerr"
 )
 
 var (
@@ -20,8 +20,7 @@ var (
 
 // CheckDuplicateKey checks if the error is a postgres duplicate key violation.
 func CheckDuplicateKey(err error) bool {
-	var pgError *pgconn.PgError
-	return errors.As(err, &pgError) && pgError.Code == "23505"
+	return errors.Is(pgerr.Classify(err), pgerr.ErrUniqueViolation)
 }
 
 // CheckPageNotFound checks if the error is a fiber page not found error.
@@ -0,0 +1,153 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"iter"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// Collection is a handle of a collection with documents of type T.
+// Its methods participate in transactions started with Mongo.WithTransaction like Mongo methods do.
+type Collection[T any] struct {
+	m    Mongo
+	name string
+}
+
+// NewCollection returns a handle of the collection name of m with documents of type T.
+func NewCollection[T any](m Mongo, name string) Collection[T] {
+	return Collection[T]{m: m, name: name}
+}
+
+// Name returns the collection name.
+func (c Collection[T]) Name() string {
+	return c.name
+}
+
+func (c Collection[T]) coll() *mongo.Collection {
+	return c.m.mongo.Database(c.m.db).Collection(c.name)
+}
+
+// Get returns a single document matching filter, the error wraps mongo.ErrNoDocuments if there is none.
+func (c Collection[T]) Get(ctx context.Context, filter Filter, opts ...*options.FindOneOptions) (T, error) {
+	ctx, span := c.m.trace(ctx, "Mongo.Collection.Get", attribute.String("collection", c.name))
+	defer span.End()
+
+	var doc T
+	if err := c.coll().FindOne(ctx, filter, opts...).Decode(&doc); err != nil {
+		desc := "failed to get document"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, desc)
+		return doc, fmt.Errorf("%s: %w", desc, err)
+	}
+	return doc, nil
+}
+
+// List returns all documents matching filter, use Iter for large result sets.
+func (c Collection[T]) List(ctx context.Context, filter Filter, opts ...*options.FindOptions) ([]T, error) {
+	ctx, span := c.m.trace(ctx, "Mongo.Collection.List", attribute.String("collection", c.name))
+	defer span.End()
+
+	cursor, err := c.coll().Find(ctx, filter, opts...)
+	if err != nil {
+		desc := "failed to list documents"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, desc)
+		return nil, fmt.Errorf("%s: %w", desc, err)
+	}
+
+	docs := []T{}
+	if err = cursor.All(ctx, &docs); err != nil {
+		desc := "failed to decode documents"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, desc)
+		return nil, fmt.Errorf("%s: %w", desc, err)
+	}
+	return docs, nil
+}
+
+// Iter returns an iterator over documents matching filter, fetching them from the cursor in batches.
+// The query runs when the iteration starts. An error is yielded at most once and ends the iteration.
+// Breaking out of the loop closes the cursor.
+func (c Collection[T]) Iter(ctx context.Context, filter Filter, opts ...*options.FindOptions) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		ctx, span := c.m.trace(ctx, "Mongo.Collection.Iter", attribute.String("collection", c.name))
+		defer span.End()
+
+		var zero T
+		fail := func(desc string, err error) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, desc)
+			yield(zero, fmt.Errorf("%s: %w", desc, err))
+		}
+
+		cursor, err := c.coll().Find(ctx, filter, opts...)
+		if err != nil {
+			fail("failed to find documents", err)
+			return
+		}
+		defer cursor.Close(context.WithoutCancel(ctx))
+
+		for cursor.Next(ctx) {
+			var doc T
+			if err = cursor.Decode(&doc); err != nil {
+				fail("failed to decode document", err)
+				return
+			}
+			if !yield(doc, nil) {
+				return
+			}
+		}
+		if err = cursor.Err(); err != nil {
+			fail("failed to iterate documents", err)
+		}
+	}
+}
+
+// Insert inserts docs and returns their ids in the same order.
+func (c Collection[T]) Insert(ctx context.Context, docs ...T) ([]interface{}, error) {
+	if len(docs) == 0 {
+		return nil, nil
+	}
+
+	ctx, span := c.m.trace(
+		ctx,
+		"Mongo.Collection.Insert",
+		attribute.String("collection", c.name),
+		attribute.Int("documents", len(docs)),
+	)
+	defer span.End()
+
+	res, err := c.coll().InsertMany(ctx, values(docs))
+	if err != nil {
+		desc := "failed to insert documents"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, desc)
+		return nil, fmt.Errorf("%s: %w", desc, err)
+	}
+	return res.InsertedIDs, nil
+}
+
+// Update applies update to a single document matching filter.
+func (c Collection[T]) Update(
+	ctx context.Context,
+	filter Filter,
+	update Update,
+	opts ...*options.UpdateOptions,
+) (*mongo.UpdateResult, error) {
+	ctx, span := c.m.trace(ctx, "Mongo.Collection.Update", attribute.String("collection", c.name))
+	defer span.End()
+
+	res, err := c.coll().UpdateOne(ctx, filter, update, opts...)
+	if err != nil {
+		desc := "failed to update document"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, desc)
+		return nil, fmt.Errorf("%s: %w", desc, err)
+	}
+	return res, nil
+}
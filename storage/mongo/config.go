@@ -14,6 +14,18 @@ type Config struct {
 	AuthType     string `yaml:"auth_type"`
 	Port         string `yaml:"port"`
 	RetryTimeout int    `yaml:"retry_timeout"`
+	// ReadConcern is a default read concern of transactions: local, majority or snapshot, server default if empty.
+	ReadConcern string `yaml:"read_concern"`
+	// WriteConcern is a default write concern of transactions: majority or a number of nodes, server default if empty.
+	WriteConcern string `yaml:"write_concern"`
+	// TxMaxCommitTimeMs limits a single commit of a transaction, unlimited if zero.
+	TxMaxCommitTimeMs int `yaml:"tx_max_commit_time_ms"`
+	// TxRetryTimeoutSec limits retries of transient transaction errors, 120 seconds if zero.
+	TxRetryTimeoutSec int `yaml:"tx_retry_timeout_sec"`
+	// Collections are collections with indexes and validators managed by Mongo.EnsureSchema.
+	Collections []CollectionConfig `yaml:"collections"`
+	// DropUndeclaredIndexes makes Mongo.EnsureSchema drop indexes of declared collections that aren't declared.
+	DropUndeclaredIndexes bool `yaml:"drop_undeclared_indexes"`
 }
 
 // URL returns the connection URL.
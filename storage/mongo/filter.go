@@ -0,0 +1,232 @@
+package mongo
+
+import (
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// ErrEmptyUpdate is an error when an Update without any operations is marshaled.
+var ErrEmptyUpdate = errors.New("update has no operations")
+
+// Number is a constraint of field types that can be incremented.
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 |
+		~float32 | ~float64
+}
+
+// Path is a path to a document field.
+type Path interface {
+	Path() string
+}
+
+// Field is a path to a document field with values of type V, it builds filters and updates checked at compile time.
+// Nested fields are separated with dots:
+//
+//	var UserCity = mongo.Field[string]("address.city")
+type Field[V any] string
+
+// Path returns the path to the field.
+func (f Field[V]) Path() string {
+	return string(f)
+}
+
+func (f Field[V]) op(op string, value interface{}) Filter {
+	return Filter{doc: bson.D{{Key: string(f), Value: bson.D{{Key: op, Value: value}}}}}
+}
+
+// Eq matches documents where the field equals v.
+func (f Field[V]) Eq(v V) Filter {
+	return f.op("$eq", v)
+}
+
+// Ne matches documents where the field doesn't equal v.
+func (f Field[V]) Ne(v V) Filter {
+	return f.op("$ne", v)
+}
+
+// Gt matches documents where the field is greater than v.
+func (f Field[V]) Gt(v V) Filter {
+	return f.op("$gt", v)
+}
+
+// Gte matches documents where the field is greater than or equal to v.
+func (f Field[V]) Gte(v V) Filter {
+	return f.op("$gte", v)
+}
+
+// Lt matches documents where the field is less than v.
+func (f Field[V]) Lt(v V) Filter {
+	return f.op("$lt", v)
+}
+
+// Lte matches documents where the field is less than or equal to v.
+func (f Field[V]) Lte(v V) Filter {
+	return f.op("$lte", v)
+}
+
+// In matches documents where the field equals any of vs.
+func (f Field[V]) In(vs ...V) Filter {
+	return f.op("$in", values(vs))
+}
+
+// Nin matches documents where the field equals none of vs.
+func (f Field[V]) Nin(vs ...V) Filter {
+	return f.op("$nin", values(vs))
+}
+
+// Exists matches documents that have the field if exists is true and documents without it otherwise.
+func (f Field[V]) Exists(exists bool) Filter {
+	return f.op("$exists", exists)
+}
+
+// Set sets the field to v.
+func (f Field[V]) Set(v V) Update {
+	return Update{ops: []updateOp{{op: "$set", field: string(f), value: v}}}
+}
+
+// Unset removes the field.
+func (f Field[V]) Unset() Update {
+	return Update{ops: []updateOp{{op: "$unset", field: string(f), value: ""}}}
+}
+
+// SetOnInsert sets the field to v only if an upsert inserts a document.
+func (f Field[V]) SetOnInsert(v V) Update {
+	return Update{ops: []updateOp{{op: "$setOnInsert", field: string(f), value: v}}}
+}
+
+// Inc increments the numeric field f by v.
+func Inc[V Number](f Field[V], v V) Update {
+	return Update{ops: []updateOp{{op: "$inc", field: string(f), value: v}}}
+}
+
+// values converts vs to a BSON array.
+func values[V any](vs []V) bson.A {
+	arr := make(bson.A, len(vs))
+	for i, v := range vs {
+		arr[i] = v
+	}
+	return arr
+}
+
+// Filter is a query filter, the zero value matches all documents.
+// It may be passed to any method accepting a filter.
+type Filter struct {
+	doc bson.D
+}
+
+// MarshalBSON implements bson.Marshaler.
+func (f Filter) MarshalBSON() ([]byte, error) {
+	if f.doc == nil {
+		return bson.Marshal(bson.D{})
+	}
+	return bson.Marshal(f.doc)
+}
+
+// And matches documents matching all filters.
+func And(filters ...Filter) Filter {
+	return Filter{doc: bson.D{{Key: "$and", Value: filterDocs(filters)}}}
+}
+
+// Or matches documents matching any of filters.
+func Or(filters ...Filter) Filter {
+	return Filter{doc: bson.D{{Key: "$or", Value: filterDocs(filters)}}}
+}
+
+// Nor matches documents matching none of filters.
+func Nor(filters ...Filter) Filter {
+	return Filter{doc: bson.D{{Key: "$nor", Value: filterDocs(filters)}}}
+}
+
+func filterDocs(filters []Filter) bson.A {
+	docs := make(bson.A, len(filters))
+	for i, f := range filters {
+		docs[i] = f
+	}
+	return docs
+}
+
+// Update is an update of fields, updates of different fields are combined with Combine.
+// The zero value has no operations and can't be marshaled.
+type Update struct {
+	ops []updateOp
+}
+
+type updateOp struct {
+	op    string
+	field string
+	value interface{}
+}
+
+// Combine combines updates into a single update.
+func Combine(updates ...Update) Update {
+	var combined Update
+	for _, u := range updates {
+		combined.ops = append(combined.ops, u.ops...)
+	}
+	return combined
+}
+
+// MarshalBSON implements bson.Marshaler, fields are grouped by update operators.
+// It returns ErrEmptyUpdate if there are no operations, because the server rejects empty updates.
+func (u Update) MarshalBSON() ([]byte, error) {
+	if len(u.ops) == 0 {
+		return nil, ErrEmptyUpdate
+	}
+
+	var ops []string
+	fields := make(map[string]bson.D)
+	for _, op := range u.ops {
+		if _, ok := fields[op.op]; !ok {
+			ops = append(ops, op.op)
+		}
+		fields[op.op] = append(fields[op.op], bson.E{Key: op.field, Value: op.value})
+	}
+
+	doc := make(bson.D, len(ops))
+	for i, op := range ops {
+		doc[i] = bson.E{Key: op, Value: fields[op]}
+	}
+	return bson.Marshal(doc)
+}
+
+// Projection selects fields returned by queries.
+// It may be passed to options.FindOptions.SetProjection and similar options.
+type Projection struct {
+	doc bson.D
+}
+
+// MarshalBSON implements bson.Marshaler.
+func (p Projection) MarshalBSON() ([]byte, error) {
+	if p.doc == nil {
+		return bson.Marshal(bson.D{})
+	}
+	return bson.Marshal(p.doc)
+}
+
+// Include returns a projection of only fields, _id is included unless excluded with ExcludeID.
+func Include(fields ...Path) Projection {
+	return projection(fields, 1)
+}
+
+// Exclude returns a projection of all fields except fields.
+func Exclude(fields ...Path) Projection {
+	return projection(fields, 0)
+}
+
+// ExcludeID excludes _id from the projection.
+func (p Projection) ExcludeID() Projection {
+	doc := make(bson.D, 0, len(p.doc)+1)
+	doc = append(doc, p.doc...)
+	p.doc = append(doc, bson.E{Key: "_id", Value: 0})
+	return p
+}
+
+func projection(fields []Path, value int32) Projection {
+	doc := make(bson.D, len(fields))
+	for i, f := range fields {
+		doc[i] = bson.E{Key: f.Path(), Value: value}
+	}
+	return Projection{doc: doc}
+}
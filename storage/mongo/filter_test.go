@@ -0,0 +1,222 @@
+package mongo
+
+import (
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+var (
+	userName   = Field[string]("name")
+	userAge    = Field[int]("age")
+	userCity   = Field[string]("address.city")
+	userScore  = Field[float64]("score")
+	userActive = Field[bool]("active")
+)
+
+// extJSON marshals v to relaxed extended JSON.
+func extJSON(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := bson.MarshalExtJSON(v, false, false)
+	if err != nil {
+		t.Fatalf("marshal %T: %v", v, err)
+	}
+	return string(data)
+}
+
+func TestFilterMarshalBSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter Filter
+		want   string
+	}{
+		{
+			name:   "zero value",
+			filter: Filter{},
+			want:   `{}`,
+		},
+		{
+			name:   "eq",
+			filter: userName.Eq("alice"),
+			want:   `{"name":{"$eq":"alice"}}`,
+		},
+		{
+			name:   "nested field",
+			filter: userCity.Ne("Paris"),
+			want:   `{"address.city":{"$ne":"Paris"}}`,
+		},
+		{
+			name:   "comparison",
+			filter: userAge.Gte(18),
+			want:   `{"age":{"$gte":18}}`,
+		},
+		{
+			name:   "in",
+			filter: userName.In("alice", "bob"),
+			want:   `{"name":{"$in":["alice","bob"]}}`,
+		},
+		{
+			name:   "nin without values",
+			filter: userName.Nin(),
+			want:   `{"name":{"$nin":[]}}`,
+		},
+		{
+			name:   "exists",
+			filter: userCity.Exists(false),
+			want:   `{"address.city":{"$exists":false}}`,
+		},
+		{
+			name:   "and",
+			filter: And(userAge.Gt(18), userAge.Lt(65)),
+			want:   `{"$and":[{"age":{"$gt":18}},{"age":{"$lt":65}}]}`,
+		},
+		{
+			name:   "nested logical",
+			filter: Or(userActive.Eq(true), Nor(userName.Eq("alice"), userAge.Lte(10))),
+			want:   `{"$or":[{"active":{"$eq":true}},{"$nor":[{"name":{"$eq":"alice"}},{"age":{"$lte":10}}]}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extJSON(t, tt.filter); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUpdateMarshalBSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		update Update
+		want   string
+	}{
+		{
+			name:   "set",
+			update: userName.Set("alice"),
+			want:   `{"$set":{"name":"alice"}}`,
+		},
+		{
+			name:   "unset",
+			update: userCity.Unset(),
+			want:   `{"$unset":{"address.city":""}}`,
+		},
+		{
+			name:   "inc",
+			update: Inc(userScore, 1.5),
+			want:   `{"$inc":{"score":1.5}}`,
+		},
+		{
+			name: "grouped by operator in order of first use",
+			update: Combine(
+				userName.Set("alice"),
+				Inc(userAge, 1),
+				userCity.Set("Paris"),
+				userActive.SetOnInsert(true),
+			),
+			want: `{"$set":{"name":"alice","address.city":"Paris"},"$inc":{"age":1},"$setOnInsert":{"active":true}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extJSON(t, tt.update); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmptyUpdateMarshalBSON(t *testing.T) {
+	for name, update := range map[string]Update{
+		"zero value":            {},
+		"combine without ops":   Combine(),
+		"combine of zero value": Combine(Update{}, Update{}),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := bson.Marshal(update); !errors.Is(err, ErrEmptyUpdate) {
+				t.Errorf("got error %v, want %v", err, ErrEmptyUpdate)
+			}
+		})
+	}
+}
+
+func TestProjectionMarshalBSON(t *testing.T) {
+	tests := []struct {
+		name       string
+		projection Projection
+		want       string
+	}{
+		{
+			name:       "zero value",
+			projection: Projection{},
+			want:       `{}`,
+		},
+		{
+			name:       "include",
+			projection: Include(userName, userCity),
+			want:       `{"name":1,"address.city":1}`,
+		},
+		{
+			name:       "exclude",
+			projection: Exclude(userScore),
+			want:       `{"score":0}`,
+		},
+		{
+			name:       "include without id",
+			projection: Include(userName).ExcludeID(),
+			want:       `{"name":1,"_id":0}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := extJSON(t, tt.projection); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProjectionExcludeIDCopies(t *testing.T) {
+	include := Include(userName, userAge)
+	withoutID := include.ExcludeID()
+
+	if got, want := extJSON(t, include), `{"name":1,"age":1}`; got != want {
+		t.Errorf("original projection changed to %s, want %s", got, want)
+	}
+	if got, want := extJSON(t, withoutID), `{"name":1,"age":1,"_id":0}`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+// newTestCollection returns a collection of a client that never connects to a server.
+func newTestCollection(t *testing.T) Collection[bson.M] {
+	t.Helper()
+	client, err := mongo.Connect(t.Context(), options.Client().ApplyURI("mongodb://127.0.0.1:1"))
+	if err != nil {
+		t.Fatalf("create client: %v", err)
+	}
+	t.Cleanup(func() { _ = client.Disconnect(t.Context()) })
+
+	m := Mongo{mongo: client, tracer: noop.NewTracerProvider().Tracer("test"), db: "test"}
+	return NewCollection[bson.M](m, "users")
+}
+
+func TestCollectionEmptyRequests(t *testing.T) {
+	c := newTestCollection(t)
+	if c.Name() != "users" {
+		t.Errorf("Name() = %q, want %q", c.Name(), "users")
+	}
+
+	ids, err := c.Insert(t.Context())
+	if err != nil || ids != nil {
+		t.Errorf("Insert() without documents = %v, %v, want nil, nil", ids, err)
+	}
+
+	if _, err = c.Update(t.Context(), userName.Eq("alice"), Update{}); !errors.Is(err, ErrEmptyUpdate) {
+		t.Errorf("Update() with an empty update error = %v, want %v", err, ErrEmptyUpdate)
+	}
+}
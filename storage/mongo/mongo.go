@@ -15,9 +15,18 @@ import (
 
 // Mongo provides a MongoDB client and tracing for operations.
 type Mongo struct {
-	mongo  *mongo.Client
-	tracer trace.Tracer
-	db     string
+	mongo          *mongo.Client
+	tracer         trace.Tracer
+	db             string
+	txOpts         *options.TransactionOptions
+	txRetryTimeout time.Duration
+	schema         schemaConfig
+}
+
+// schemaConfig is the part of Config used by EnsureSchema.
+type schemaConfig struct {
+	Collections           []CollectionConfig
+	DropUndeclaredIndexes bool
 }
 
 // New creates a new Mongo instance.
@@ -25,15 +34,31 @@ func New(cfg *Config, tracer trace.Tracer) (Mongo, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.RetryTimeout)*time.Second)
 	defer cancel()
 
+	txOpts, err := transactionOptions(cfg)
+	if err != nil {
+		return Mongo{}, err
+	}
+
+	txRetryTimeout := defaultTxRetryTimeout
+	if cfg.TxRetryTimeoutSec > 0 {
+		txRetryTimeout = time.Duration(cfg.TxRetryTimeoutSec) * time.Second
+	}
+
 	client, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.URL()))
 	if err != nil {
 		return Mongo{}, fmt.Errorf("failed to create mongo client: %w", err)
 	}
 
 	return Mongo{
-		db:     cfg.DB,
-		mongo:  client,
-		tracer: tracer,
+		db:             cfg.DB,
+		mongo:          client,
+		tracer:         tracer,
+		txOpts:         txOpts,
+		txRetryTimeout: txRetryTimeout,
+		schema: schemaConfig{
+			Collections:           cfg.Collections,
+			DropUndeclaredIndexes: cfg.DropUndeclaredIndexes,
+		},
 	}, nil
 }
 
@@ -184,3 +209,276 @@ func (m Mongo) DeleteOne(
 	}
 	return res, nil
 }
+
+// InsertMany inserts multiple documents into the given collection.
+func (m Mongo) InsertMany(
+	ctx context.Context,
+	coll string,
+	docs []interface{},
+	opts ...*options.InsertManyOptions,
+) (*mongo.InsertManyResult, error) {
+	if m.tracer != nil {
+		var span trace.Span
+		ctx, span = m.tracer.Start(ctx, "Mongo.InsertMany", trace.WithAttributes(
+			attribute.String("collection", coll),
+			attribute.Int("documents", len(docs)),
+		))
+		defer span.End()
+	}
+
+	res, err := m.mongo.Database(m.db).Collection(coll).InsertMany(ctx, docs, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to insert many documents: %w", err)
+	}
+	return res, nil
+}
+
+// DeleteMany deletes multiple documents from the given collection.
+func (m Mongo) DeleteMany(
+	ctx context.Context,
+	coll string,
+	filter interface{},
+	opts ...*options.DeleteOptions,
+) (*mongo.DeleteResult, error) {
+	if m.tracer != nil {
+		var span trace.Span
+		ctx, span = m.tracer.Start(ctx, "Mongo.DeleteMany", trace.WithAttributes(
+			attribute.String("collection", coll),
+		))
+		defer span.End()
+	}
+
+	res, err := m.mongo.Database(m.db).Collection(coll).DeleteMany(ctx, filter, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete many documents: %w", err)
+	}
+	return res, nil
+}
+
+// ReplaceOne replaces a single document in the given collection.
+func (m Mongo) ReplaceOne(
+	ctx context.Context,
+	coll string,
+	filter, replacement interface{},
+	opts ...*options.ReplaceOptions,
+) (*mongo.UpdateResult, error) {
+	if m.tracer != nil {
+		var span trace.Span
+		ctx, span = m.tracer.Start(ctx, "Mongo.ReplaceOne", trace.WithAttributes(
+			attribute.String("collection", coll),
+		))
+		defer span.End()
+	}
+
+	res, err := m.mongo.Database(m.db).Collection(coll).ReplaceOne(ctx, filter, replacement, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to replace one document: %w", err)
+	}
+	return res, nil
+}
+
+// UpsertOne updates a single document in the given collection or inserts it if none matches filter.
+func (m Mongo) UpsertOne(
+	ctx context.Context,
+	coll string,
+	filter, update interface{},
+	opts ...*options.UpdateOptions,
+) (*mongo.UpdateResult, error) {
+	// a new slice, appending to opts could overwrite the caller's backing array
+	upsertOpts := append(append([]*options.UpdateOptions{}, opts...), options.Update().SetUpsert(true))
+	return m.UpdateOne(ctx, coll, filter, update, upsertOpts...)
+}
+
+// UpsertReplaceOne replaces a single document in the given collection or inserts it if none matches filter.
+func (m Mongo) UpsertReplaceOne(
+	ctx context.Context,
+	coll string,
+	filter, replacement interface{},
+	opts ...*options.ReplaceOptions,
+) (*mongo.UpdateResult, error) {
+	upsertOpts := append(append([]*options.ReplaceOptions{}, opts...), options.Replace().SetUpsert(true))
+	return m.ReplaceOne(ctx, coll, filter, replacement, upsertOpts...)
+}
+
+// BulkWrite executes multiple write operations in the given collection.
+func (m Mongo) BulkWrite(
+	ctx context.Context,
+	coll string,
+	models []mongo.WriteModel,
+	opts ...*options.BulkWriteOptions,
+) (*mongo.BulkWriteResult, error) {
+	if m.tracer != nil {
+		var span trace.Span
+		ctx, span = m.tracer.Start(ctx, "Mongo.BulkWrite", trace.WithAttributes(
+			attribute.String("collection", coll),
+			attribute.Int("operations", len(models)),
+		))
+		defer span.End()
+	}
+
+	res, err := m.mongo.Database(m.db).Collection(coll).BulkWrite(ctx, models, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to bulk write: %w", err)
+	}
+	return res, nil
+}
+
+// Aggregate runs an aggregation pipeline on the given collection and decodes all results into dest.
+func (m Mongo) Aggregate(
+	ctx context.Context,
+	coll string,
+	pipeline, dest interface{},
+	opts ...*options.AggregateOptions,
+) error {
+	if m.tracer != nil {
+		var span trace.Span
+		ctx, span = m.tracer.Start(ctx, "Mongo.Aggregate", trace.WithAttributes(
+			attribute.String("collection", coll),
+		))
+		defer span.End()
+	}
+
+	cursor, err := m.mongo.Database(m.db).Collection(coll).Aggregate(ctx, pipeline, opts...)
+	if err != nil {
+		return fmt.Errorf("failed to aggregate: %w", err)
+	}
+
+	if err = cursor.All(ctx, dest); err != nil {
+		return fmt.Errorf("failed to decode aggregation results: %w", err)
+	}
+	return nil
+}
+
+// CountDocuments counts documents matching filter in the given collection.
+func (m Mongo) CountDocuments(
+	ctx context.Context,
+	coll string,
+	filter interface{},
+	opts ...*options.CountOptions,
+) (int64, error) {
+	if m.tracer != nil {
+		var span trace.Span
+		ctx, span = m.tracer.Start(ctx, "Mongo.CountDocuments", trace.WithAttributes(
+			attribute.String("collection", coll),
+		))
+		defer span.End()
+	}
+
+	count, err := m.mongo.Database(m.db).Collection(coll).CountDocuments(ctx, filter, opts...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count documents: %w", err)
+	}
+	return count, nil
+}
+
+// EstimatedDocumentCount returns an estimate of the number of documents in the given collection using its metadata.
+func (m Mongo) EstimatedDocumentCount(
+	ctx context.Context,
+	coll string,
+	opts ...*options.EstimatedDocumentCountOptions,
+) (int64, error) {
+	if m.tracer != nil {
+		var span trace.Span
+		ctx, span = m.tracer.Start(ctx, "Mongo.EstimatedDocumentCount", trace.WithAttributes(
+			attribute.String("collection", coll),
+		))
+		defer span.End()
+	}
+
+	count, err := m.mongo.Database(m.db).Collection(coll).EstimatedDocumentCount(ctx, opts...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to estimate document count: %w", err)
+	}
+	return count, nil
+}
+
+// Distinct finds distinct values of the field among documents matching filter in the given collection.
+func (m Mongo) Distinct(
+	ctx context.Context,
+	coll string,
+	field string,
+	filter interface{},
+	opts ...*options.DistinctOptions,
+) ([]interface{}, error) {
+	if m.tracer != nil {
+		var span trace.Span
+		ctx, span = m.tracer.Start(ctx, "Mongo.Distinct", trace.WithAttributes(
+			attribute.String("collection", coll),
+			attribute.String("field", field),
+		))
+		defer span.End()
+	}
+
+	values, err := m.mongo.Database(m.db).Collection(coll).Distinct(ctx, field, filter, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find distinct values: %w", err)
+	}
+	return values, nil
+}
+
+// FindOneAndUpdate updates a single document in the given collection and decodes it into dest.
+// The document before the update is decoded unless opts set the return document to options.After.
+func (m Mongo) FindOneAndUpdate(
+	ctx context.Context,
+	coll string,
+	filter, update, dest interface{},
+	opts ...*options.FindOneAndUpdateOptions,
+) error {
+	if m.tracer != nil {
+		var span trace.Span
+		ctx, span = m.tracer.Start(ctx, "Mongo.FindOneAndUpdate", trace.WithAttributes(
+			attribute.String("collection", coll),
+		))
+		defer span.End()
+	}
+
+	res := m.mongo.Database(m.db).Collection(coll).FindOneAndUpdate(ctx, filter, update, opts...)
+	if err := res.Decode(dest); err != nil {
+		return fmt.Errorf("failed to find and update one document: %w", err)
+	}
+	return nil
+}
+
+// FindOneAndReplace replaces a single document in the given collection and decodes it into dest.
+// The document before the replacement is decoded unless opts set the return document to options.After.
+func (m Mongo) FindOneAndReplace(
+	ctx context.Context,
+	coll string,
+	filter, replacement, dest interface{},
+	opts ...*options.FindOneAndReplaceOptions,
+) error {
+	if m.tracer != nil {
+		var span trace.Span
+		ctx, span = m.tracer.Start(ctx, "Mongo.FindOneAndReplace", trace.WithAttributes(
+			attribute.String("collection", coll),
+		))
+		defer span.End()
+	}
+
+	res := m.mongo.Database(m.db).Collection(coll).FindOneAndReplace(ctx, filter, replacement, opts...)
+	if err := res.Decode(dest); err != nil {
+		return fmt.Errorf("failed to find and replace one document: %w", err)
+	}
+	return nil
+}
+
+// FindOneAndDelete deletes a single document from the given collection and decodes it into dest.
+func (m Mongo) FindOneAndDelete(
+	ctx context.Context,
+	coll string,
+	filter, dest interface{},
+	opts ...*options.FindOneAndDeleteOptions,
+) error {
+	if m.tracer != nil {
+		var span trace.Span
+		ctx, span = m.tracer.Start(ctx, "Mongo.FindOneAndDelete", trace.WithAttributes(
+			attribute.String("collection", coll),
+		))
+		defer span.End()
+	}
+
+	if err := m.mongo.Database(m.db).Collection(coll).FindOneAndDelete(ctx, filter, opts...).Decode(dest); err != nil {
+		return fmt.Errorf("failed to find and delete one document: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,448 @@
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+// Index key types of IndexKey.
+const (
+	IndexAsc      = "asc"
+	IndexDesc     = "desc"
+	IndexText     = "text"
+	IndexHashed   = "hashed"
+	Index2DSphere = "2dsphere"
+)
+
+const (
+	// idIndex is the default index of every collection, it's never reported or dropped.
+	idIndex = "_id_"
+	// defaultTextLanguage is the language of text indexes declared without one.
+	defaultTextLanguage = "english"
+)
+
+// CollectionConfig declares a collection managed by Mongo.EnsureSchema.
+type CollectionConfig struct {
+	Name    string        `yaml:"name"`
+	Indexes []IndexConfig `yaml:"indexes"`
+	// Validator is a JSON schema documents are validated against.
+	Validator map[string]interface{} `yaml:"validator"`
+	// ValidationLevel is strict, moderate or off, server default if empty.
+	ValidationLevel string `yaml:"validation_level"`
+	// ValidationAction is error or warn, server default if empty.
+	ValidationAction string `yaml:"validation_action"`
+	// Capped makes the collection capped, it's applied only when the collection is created.
+	Capped *CappedConfig `yaml:"capped"`
+	// TimeSeries makes the collection a time series, it's applied only when the collection is created.
+	TimeSeries *TimeSeriesConfig `yaml:"time_series"`
+}
+
+// CappedConfig is the configuration for a capped collection.
+type CappedConfig struct {
+	SizeBytes    int64 `yaml:"size_bytes"`
+	MaxDocuments int64 `yaml:"max_documents"`
+}
+
+// TimeSeriesConfig is the configuration for a time series collection.
+type TimeSeriesConfig struct {
+	TimeField string `yaml:"time_field"`
+	MetaField string `yaml:"meta_field"`
+	// Granularity is seconds, minutes or hours, server default if empty.
+	Granularity string `yaml:"granularity"`
+	// ExpireAfterSec removes documents older than this, never if zero.
+	ExpireAfterSec int64 `yaml:"expire_after_sec"`
+}
+
+// IndexConfig declares an index of a collection.
+type IndexConfig struct {
+	// Name is the index name, generated from keys like the server does if empty.
+	Name   string     `yaml:"name"`
+	Keys   []IndexKey `yaml:"keys"`
+	Unique bool       `yaml:"unique"`
+	Sparse bool       `yaml:"sparse"`
+	// ExpireAfterSec makes a TTL index removing documents this long after the time in the indexed field.
+	ExpireAfterSec *int32 `yaml:"expire_after_sec"`
+	// PartialFilter indexes only documents matching the filter.
+	PartialFilter map[string]interface{} `yaml:"partial_filter"`
+	// Weights are weights of fields of a text index.
+	Weights map[string]int32 `yaml:"weights"`
+	// DefaultLanguage is the language of a text index.
+	DefaultLanguage string `yaml:"default_language"`
+}
+
+// IndexKey is a field of an index.
+type IndexKey struct {
+	Field string `yaml:"field"`
+	// Type is asc, desc, text, hashed or 2dsphere, asc by default.
+	Type string `yaml:"type"`
+}
+
+// value returns the key value used in index specifications.
+func (k IndexKey) value() interface{} {
+	switch k.Type {
+	case "", IndexAsc:
+		return int32(1)
+	case IndexDesc:
+		return int32(-1)
+	default:
+		return k.Type
+	}
+}
+
+// keys returns the index keys document.
+func (c IndexConfig) keys() bson.D {
+	keys := make(bson.D, len(c.Keys))
+	for i, k := range c.Keys {
+		keys[i] = bson.E{Key: k.Field, Value: k.value()}
+	}
+	return keys
+}
+
+// name returns the declared name or the name generated by the server.
+func (c IndexConfig) name() string {
+	if c.Name != "" {
+		return c.Name
+	}
+
+	parts := make([]string, 0, len(c.Keys)*2)
+	for _, k := range c.Keys {
+		parts = append(parts, k.Field, fmt.Sprint(k.value()))
+	}
+	return strings.Join(parts, "_")
+}
+
+func (c IndexConfig) isText() bool {
+	return slices.ContainsFunc(c.Keys, func(k IndexKey) bool { return k.Type == IndexText })
+}
+
+// model returns the index model to create the index.
+func (c IndexConfig) model() mongo.IndexModel {
+	opts := options.Index().SetName(c.name())
+	if c.Unique {
+		opts.SetUnique(true)
+	}
+	if c.Sparse {
+		opts.SetSparse(true)
+	}
+	if c.ExpireAfterSec != nil {
+		opts.SetExpireAfterSeconds(*c.ExpireAfterSec)
+	}
+	if c.PartialFilter != nil {
+		opts.SetPartialFilterExpression(c.PartialFilter)
+	}
+	if c.Weights != nil {
+		opts.SetWeights(c.Weights)
+	}
+	if c.DefaultLanguage != "" {
+		opts.SetDefaultLanguage(c.DefaultLanguage)
+	}
+	return mongo.IndexModel{Keys: c.keys(), Options: opts}
+}
+
+// existingIndex is an index specification returned by the server.
+type existingIndex struct {
+	Name               string   `bson:"name"`
+	Key                bson.D   `bson:"key"`
+	Unique             bool     `bson:"unique"`
+	Sparse             bool     `bson:"sparse"`
+	ExpireAfterSeconds *int32   `bson:"expireAfterSeconds"`
+	PartialFilter      bson.Raw `bson:"partialFilterExpression"`
+	Weights            bson.M   `bson:"weights"`
+	DefaultLanguage    string   `bson:"default_language"`
+}
+
+// drift describes differences of the existing index from the declared one, empty if there are none.
+func (c IndexConfig) drift(existing existingIndex) string {
+	var diffs []string
+
+	// text indexes are stored with internal keys, their fields can't be compared
+	if !c.isText() && !sameKeys(c.keys(), existing.Key) {
+		diffs = append(diffs, "keys")
+	}
+	if c.Unique != existing.Unique {
+		diffs = append(diffs, "unique")
+	}
+	if c.Sparse != existing.Sparse {
+		diffs = append(diffs, "sparse")
+	}
+	if (c.ExpireAfterSec == nil) != (existing.ExpireAfterSeconds == nil) ||
+		(c.ExpireAfterSec != nil && *c.ExpireAfterSec != *existing.ExpireAfterSeconds) {
+		diffs = append(diffs, "expire after")
+	}
+	if !sameDocument(c.PartialFilter, existing.PartialFilter) {
+		diffs = append(diffs, "partial filter")
+	}
+	if c.isText() {
+		if !sameWeights(c.weights(), existing.Weights) {
+			diffs = append(diffs, "weights")
+		}
+		if c.defaultLanguage() != existing.DefaultLanguage {
+			diffs = append(diffs, "default language")
+		}
+	}
+	return strings.Join(diffs, ", ")
+}
+
+// weights returns weights of all fields of a text index, fields without a declared weight have weight 1.
+func (c IndexConfig) weights() map[string]int32 {
+	weights := make(map[string]int32, len(c.Keys)+len(c.Weights))
+	for _, k := range c.Keys {
+		if k.Type == IndexText {
+			weights[k.Field] = 1
+		}
+	}
+	for field, weight := range c.Weights {
+		weights[field] = weight
+	}
+	return weights
+}
+
+// defaultLanguage returns the declared language of a text index or the server default.
+func (c IndexConfig) defaultLanguage() string {
+	if c.DefaultLanguage != "" {
+		return c.DefaultLanguage
+	}
+	return defaultTextLanguage
+}
+
+// sameWeights compares text index weights ignoring numeric types of existing weights.
+func sameWeights(declared map[string]int32, existing bson.M) bool {
+	if len(declared) != len(existing) {
+		return false
+	}
+	for field, weight := range declared {
+		value, ok := existing[field]
+		if !ok || keyValue(weight) != keyValue(value) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameKeys compares index keys ignoring numeric types of key values.
+func sameKeys(declared, existing bson.D) bool {
+	if len(declared) != len(existing) {
+		return false
+	}
+	for i := range declared {
+		if declared[i].Key != existing[i].Key || keyValue(declared[i].Value) != keyValue(existing[i].Value) {
+			return false
+		}
+	}
+	return true
+}
+
+func keyValue(v interface{}) string {
+	switch n := v.(type) {
+	case int32:
+		return strconv.Itoa(int(n))
+	case int64:
+		return strconv.FormatInt(n, 10)
+	case float64:
+		return strconv.FormatFloat(n, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// sameDocument compares declared and existing documents after a round trip through BSON.
+func sameDocument(declared map[string]interface{}, existing bson.Raw) bool {
+	if declared == nil || existing == nil {
+		return declared == nil && existing == nil
+	}
+
+	data, err := bson.Marshal(declared)
+	if err != nil {
+		return false
+	}
+	var want, got bson.M
+	if bson.Unmarshal(data, &want) != nil || bson.Unmarshal(existing, &got) != nil {
+		return false
+	}
+	return reflect.DeepEqual(want, got)
+}
+
+// IndexDrift is a declared index that exists with different options.
+type IndexDrift struct {
+	Collection string
+	Index      string
+	// Diff lists the differing options.
+	Diff string
+}
+
+// SchemaReport describes changes made and found by EnsureSchema.
+type SchemaReport struct {
+	CreatedCollections []string
+	// CreatedIndexes are "collection.index" names.
+	CreatedIndexes []string
+	// DriftedIndexes aren't changed, they have to be dropped to be recreated.
+	DriftedIndexes []IndexDrift
+	// UndeclaredIndexes are "collection.index" names of existing indexes that aren't declared.
+	UndeclaredIndexes []string
+	// DroppedIndexes are undeclared indexes dropped when Config.DropUndeclaredIndexes is set.
+	DroppedIndexes []string
+}
+
+// EnsureSchema reconciles collections declared in Config with the database. It's safe to call on every start.
+// Missing collections and indexes are created and validation settings of existing collections are updated.
+// Indexes with options different from declared are reported as drifted, undeclared indexes
+// of declared collections are reported or dropped if Config.DropUndeclaredIndexes is set.
+func (m Mongo) EnsureSchema(ctx context.Context) (SchemaReport, error) {
+	ctx, span := m.trace(ctx, "Mongo.EnsureSchema", attribute.Int("collections", len(m.schema.Collections)))
+	defer span.End()
+
+	var report SchemaReport
+	if len(m.schema.Collections) == 0 {
+		return report, nil
+	}
+
+	db := m.mongo.Database(m.db)
+	names, err := db.ListCollectionNames(ctx, bson.D{})
+	if err != nil {
+		desc := "failed to list collections"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, desc)
+		return report, fmt.Errorf("%s: %w", desc, err)
+	}
+
+	for _, coll := range m.schema.Collections {
+		if err = m.ensureCollection(ctx, db, coll, slices.Contains(names, coll.Name), &report); err != nil {
+			desc := "failed to ensure collection"
+			span.RecordError(err)
+			span.SetStatus(codes.Error, desc)
+			return report, fmt.Errorf("%s %s: %w", desc, coll.Name, err)
+		}
+	}
+	return report, nil
+}
+
+func (m Mongo) ensureCollection(
+	ctx context.Context,
+	db *mongo.Database,
+	coll CollectionConfig,
+	exists bool,
+	report *SchemaReport,
+) error {
+	if !exists {
+		if err := db.CreateCollection(ctx, coll.Name, collectionOptions(coll)); err != nil {
+			return fmt.Errorf("create collection: %w", err)
+		}
+		report.CreatedCollections = append(report.CreatedCollections, coll.Name)
+	} else if cmd, ok := validationCommand(coll); ok {
+		if err := db.RunCommand(ctx, cmd).Err(); err != nil {
+			return fmt.Errorf("update validator: %w", err)
+		}
+	}
+
+	cursor, err := db.Collection(coll.Name).Indexes().List(ctx)
+	if err != nil {
+		return fmt.Errorf("list indexes: %w", err)
+	}
+	var existing []existingIndex
+	if err = cursor.All(ctx, &existing); err != nil {
+		return fmt.Errorf("decode indexes: %w", err)
+	}
+
+	declared := make(map[string]struct{}, len(coll.Indexes))
+	for _, index := range coll.Indexes {
+		name := index.name()
+		declared[name] = struct{}{}
+
+		i := slices.IndexFunc(existing, func(e existingIndex) bool { return e.Name == name })
+		if i >= 0 {
+			if diff := index.drift(existing[i]); diff != "" {
+				report.DriftedIndexes = append(report.DriftedIndexes, IndexDrift{
+					Collection: coll.Name,
+					Index:      name,
+					Diff:       diff,
+				})
+			}
+			continue
+		}
+
+		if _, err = db.Collection(coll.Name).Indexes().CreateOne(ctx, index.model()); err != nil {
+			return fmt.Errorf("create index %s: %w", name, err)
+		}
+		report.CreatedIndexes = append(report.CreatedIndexes, coll.Name+"."+name)
+	}
+
+	for _, index := range existing {
+		if _, ok := declared[index.Name]; ok || index.Name == idIndex {
+			continue
+		}
+
+		if !m.schema.DropUndeclaredIndexes {
+			report.UndeclaredIndexes = append(report.UndeclaredIndexes, coll.Name+"."+index.Name)
+			continue
+		}
+		if _, err = db.Collection(coll.Name).Indexes().DropOne(ctx, index.Name); err != nil {
+			return fmt.Errorf("drop index %s: %w", index.Name, err)
+		}
+		report.DroppedIndexes = append(report.DroppedIndexes, coll.Name+"."+index.Name)
+	}
+	return nil
+}
+
+// validationCommand returns the collMod command applying validation settings of coll,
+// false if none of them are declared.
+func validationCommand(coll CollectionConfig) (bson.D, bool) {
+	if coll.Validator == nil && coll.ValidationLevel == "" && coll.ValidationAction == "" {
+		return nil, false
+	}
+
+	cmd := bson.D{{Key: "collMod", Value: coll.Name}}
+	if coll.Validator != nil {
+		cmd = append(cmd, bson.E{Key: "validator", Value: bson.M{"$jsonSchema": coll.Validator}})
+	}
+	if coll.ValidationLevel != "" {
+		cmd = append(cmd, bson.E{Key: "validationLevel", Value: coll.ValidationLevel})
+	}
+	if coll.ValidationAction != "" {
+		cmd = append(cmd, bson.E{Key: "validationAction", Value: coll.ValidationAction})
+	}
+	return cmd, true
+}
+
+// collectionOptions returns options to create coll.
+func collectionOptions(coll CollectionConfig) *options.CreateCollectionOptions {
+	opts := options.CreateCollection()
+	if coll.Validator != nil {
+		opts.SetValidator(bson.M{"$jsonSchema": coll.Validator})
+	}
+	if coll.ValidationLevel != "" {
+		opts.SetValidationLevel(coll.ValidationLevel)
+	}
+	if coll.ValidationAction != "" {
+		opts.SetValidationAction(coll.ValidationAction)
+	}
+	if coll.Capped != nil {
+		opts.SetCapped(true).SetSizeInBytes(coll.Capped.SizeBytes)
+		if coll.Capped.MaxDocuments > 0 {
+			opts.SetMaxDocuments(coll.Capped.MaxDocuments)
+		}
+	}
+	if ts := coll.TimeSeries; ts != nil {
+		tsOpts := options.TimeSeries().SetTimeField(ts.TimeField)
+		if ts.MetaField != "" {
+			tsOpts.SetMetaField(ts.MetaField)
+		}
+		if ts.Granularity != "" {
+			tsOpts.SetGranularity(ts.Granularity)
+		}
+		opts.SetTimeSeriesOptions(tsOpts)
+		if ts.ExpireAfterSec > 0 {
+			opts.SetExpireAfterSeconds(ts.ExpireAfterSec)
+		}
+	}
+	return opts
+}
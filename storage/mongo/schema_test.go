@@ -0,0 +1,333 @@
+package mongo
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestIndexConfigName(t *testing.T) {
+	tests := []struct {
+		name  string
+		index IndexConfig
+		want  string
+	}{
+		{
+			name:  "declared",
+			index: IndexConfig{Name: "by_email", Keys: []IndexKey{{Field: "email"}}},
+			want:  "by_email",
+		},
+		{
+			name:  "asc by default",
+			index: IndexConfig{Keys: []IndexKey{{Field: "email"}}},
+			want:  "email_1",
+		},
+		{
+			name: "compound",
+			index: IndexConfig{Keys: []IndexKey{
+				{Field: "tenant", Type: IndexAsc},
+				{Field: "created_at", Type: IndexDesc},
+			}},
+			want: "tenant_1_created_at_-1",
+		},
+		{
+			name: "special types",
+			index: IndexConfig{Keys: []IndexKey{
+				{Field: "title", Type: IndexText},
+				{Field: "location", Type: Index2DSphere},
+			}},
+			want: "title_text_location_2dsphere",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.index.name(); got != tt.want {
+				t.Errorf("name() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSameKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		declared bson.D
+		existing bson.D
+		want     bool
+	}{
+		{
+			name:     "numeric types differ",
+			declared: bson.D{{Key: "a", Value: int32(1)}, {Key: "b", Value: int32(-1)}},
+			existing: bson.D{{Key: "a", Value: float64(1)}, {Key: "b", Value: int64(-1)}},
+			want:     true,
+		},
+		{
+			name:     "string types",
+			declared: bson.D{{Key: "h", Value: IndexHashed}},
+			existing: bson.D{{Key: "h", Value: IndexHashed}},
+			want:     true,
+		},
+		{
+			name:     "direction differs",
+			declared: bson.D{{Key: "a", Value: int32(1)}},
+			existing: bson.D{{Key: "a", Value: int32(-1)}},
+		},
+		{
+			name:     "order differs",
+			declared: bson.D{{Key: "a", Value: int32(1)}, {Key: "b", Value: int32(1)}},
+			existing: bson.D{{Key: "b", Value: int32(1)}, {Key: "a", Value: int32(1)}},
+		},
+		{
+			name:     "length differs",
+			declared: bson.D{{Key: "a", Value: int32(1)}},
+			existing: bson.D{{Key: "a", Value: int32(1)}, {Key: "b", Value: int32(1)}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sameKeys(tt.declared, tt.existing); got != tt.want {
+				t.Errorf("sameKeys() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSameDocument(t *testing.T) {
+	raw := func(t *testing.T, doc interface{}) bson.Raw {
+		t.Helper()
+		data, err := bson.Marshal(doc)
+		if err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+		return data
+	}
+
+	tests := []struct {
+		name     string
+		declared map[string]interface{}
+		existing interface{}
+		want     bool
+	}{
+		{
+			name: "both empty",
+			want: true,
+		},
+		{
+			name:     "same",
+			declared: map[string]interface{}{"status": "active", "age": map[string]interface{}{"$gt": int32(18)}},
+			existing: bson.D{
+				{Key: "status", Value: "active"},
+				{Key: "age", Value: bson.D{{Key: "$gt", Value: int32(18)}}},
+			},
+			want: true,
+		},
+		{
+			name:     "value differs",
+			declared: map[string]interface{}{"status": "active"},
+			existing: bson.D{{Key: "status", Value: "deleted"}},
+		},
+		{
+			name:     "declared only",
+			declared: map[string]interface{}{"status": "active"},
+		},
+		{
+			name:     "existing only",
+			existing: bson.D{{Key: "status", Value: "active"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var existing bson.Raw
+			if tt.existing != nil {
+				existing = raw(t, tt.existing)
+			}
+			if got := sameDocument(tt.declared, existing); got != tt.want {
+				t.Errorf("sameDocument() = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndexConfigDrift(t *testing.T) {
+	ttl := int32(3600)
+	otherTTL := int32(60)
+
+	tests := []struct {
+		name     string
+		index    IndexConfig
+		existing existingIndex
+		want     string
+	}{
+		{
+			name:  "same",
+			index: IndexConfig{Keys: []IndexKey{{Field: "email"}}, Unique: true, ExpireAfterSec: &ttl},
+			existing: existingIndex{
+				Key:                bson.D{{Key: "email", Value: int32(1)}},
+				Unique:             true,
+				ExpireAfterSeconds: &ttl,
+			},
+		},
+		{
+			name:  "keys",
+			index: IndexConfig{Keys: []IndexKey{{Field: "email", Type: IndexDesc}}},
+			existing: existingIndex{
+				Key: bson.D{{Key: "email", Value: int32(1)}},
+			},
+			want: "keys",
+		},
+		{
+			name:  "options",
+			index: IndexConfig{Keys: []IndexKey{{Field: "email"}}, Unique: true, ExpireAfterSec: &ttl},
+			existing: existingIndex{
+				Key:                bson.D{{Key: "email", Value: int32(1)}},
+				Sparse:             true,
+				ExpireAfterSeconds: &otherTTL,
+			},
+			want: "unique, sparse, expire after",
+		},
+		{
+			name:  "expire after removed",
+			index: IndexConfig{Keys: []IndexKey{{Field: "created_at"}}},
+			existing: existingIndex{
+				Key:                bson.D{{Key: "created_at", Value: int32(1)}},
+				ExpireAfterSeconds: &ttl,
+			},
+			want: "expire after",
+		},
+		{
+			name: "partial filter",
+			index: IndexConfig{
+				Keys:          []IndexKey{{Field: "email"}},
+				PartialFilter: map[string]interface{}{"deleted": false},
+			},
+			existing: existingIndex{
+				Key: bson.D{{Key: "email", Value: int32(1)}},
+			},
+			want: "partial filter",
+		},
+		{
+			name: "text index with defaults",
+			index: IndexConfig{Keys: []IndexKey{
+				{Field: "title", Type: IndexText},
+				{Field: "body", Type: IndexText},
+			}},
+			existing: existingIndex{
+				Key:             bson.D{{Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: int32(1)}},
+				Weights:         bson.M{"title": int32(1), "body": int32(1)},
+				DefaultLanguage: "english",
+			},
+		},
+		{
+			name: "text index with declared weights",
+			index: IndexConfig{
+				Keys:            []IndexKey{{Field: "title", Type: IndexText}, {Field: "body", Type: IndexText}},
+				Weights:         map[string]int32{"title": 10},
+				DefaultLanguage: "spanish",
+			},
+			existing: existingIndex{
+				Key:             bson.D{{Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: int32(1)}},
+				Weights:         bson.M{"title": int32(10), "body": int32(1)},
+				DefaultLanguage: "spanish",
+			},
+		},
+		{
+			name: "text index weights and language",
+			index: IndexConfig{
+				Keys:    []IndexKey{{Field: "title", Type: IndexText}, {Field: "body", Type: IndexText}},
+				Weights: map[string]int32{"title": 10},
+			},
+			existing: existingIndex{
+				Key:             bson.D{{Key: "_fts", Value: "text"}, {Key: "_ftsx", Value: int32(1)}},
+				Weights:         bson.M{"title": int32(5), "body": int32(1)},
+				DefaultLanguage: "spanish",
+			},
+			want: "weights, default language",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.index.drift(tt.existing); got != tt.want {
+				t.Errorf("drift() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidationCommand(t *testing.T) {
+	tests := []struct {
+		name string
+		coll CollectionConfig
+		want bson.D
+	}{
+		{
+			name: "nothing declared",
+			coll: CollectionConfig{Name: "users"},
+		},
+		{
+			name: "level without validator",
+			coll: CollectionConfig{Name: "users", ValidationLevel: "moderate"},
+			want: bson.D{{Key: "collMod", Value: "users"}, {Key: "validationLevel", Value: "moderate"}},
+		},
+		{
+			name: "action without validator",
+			coll: CollectionConfig{Name: "users", ValidationAction: "warn"},
+			want: bson.D{{Key: "collMod", Value: "users"}, {Key: "validationAction", Value: "warn"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := validationCommand(tt.coll)
+			if ok != (tt.want != nil) {
+				t.Fatalf("validationCommand() ok = %t, want %t", ok, tt.want != nil)
+			}
+			if !sameCommand(t, got, tt.want) {
+				t.Errorf("validationCommand() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("validator", func(t *testing.T) {
+		coll := CollectionConfig{
+			Name:             "users",
+			Validator:        map[string]interface{}{"required": []string{"email"}},
+			ValidationLevel:  "strict",
+			ValidationAction: "error",
+		}
+		got, ok := validationCommand(coll)
+		if !ok {
+			t.Fatal("validationCommand() ok = false, want true")
+		}
+
+		keys := make([]string, len(got))
+		for i, e := range got {
+			keys[i] = e.Key
+		}
+		want := []string{"collMod", "validator", "validationLevel", "validationAction"}
+		if len(keys) != len(want) {
+			t.Fatalf("command keys = %v, want %v", keys, want)
+		}
+		for i := range want {
+			if keys[i] != want[i] {
+				t.Fatalf("command keys = %v, want %v", keys, want)
+			}
+		}
+	})
+}
+
+// sameCommand compares commands by their extended JSON.
+func sameCommand(t *testing.T, got, want bson.D) bool {
+	t.Helper()
+	if got == nil || want == nil {
+		return got == nil && want == nil
+	}
+
+	gotJSON, err := bson.MarshalExtJSON(got, false, false)
+	if err != nil {
+		t.Fatalf("marshal command: %v", err)
+	}
+	wantJSON, err := bson.MarshalExtJSON(want, false, false)
+	if err != nil {
+		t.Fatalf("marshal command: %v", err)
+	}
+	return string(gotJSON) == string(wantJSON)
+}
@@ -0,0 +1,215 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readconcern"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultTxRetryTimeout = 120 * time.Second
+
+	commitBackoffBase = 10 * time.Millisecond
+	commitBackoffMax  = time.Second
+
+	labelTransientTransactionError      = "TransientTransactionError"
+	labelUnknownTransactionCommitResult = "UnknownTransactionCommitResult"
+)
+
+type contextKey uint8
+
+// TxKey is a key for the session of the transaction stored in context.
+const TxKey contextKey = iota
+
+var (
+	// ErrInvalidWriteConcern is an error when the write concern in Config is neither majority nor a number.
+	ErrInvalidWriteConcern = errors.New("invalid write concern")
+	// ErrNoTxFound is an error when no transaction was found, but tried to access it.
+	ErrNoTxFound = errors.New("no transaction found")
+)
+
+// transactionOptions returns default transaction options from cfg.
+func transactionOptions(cfg *Config) (*options.TransactionOptions, error) {
+	opts := options.Transaction()
+	if cfg.ReadConcern != "" {
+		opts.SetReadConcern(readconcern.New(readconcern.Level(cfg.ReadConcern)))
+	}
+
+	switch cfg.WriteConcern {
+	case "":
+	case "majority":
+		opts.SetWriteConcern(writeconcern.Majority())
+	default:
+		w, err := strconv.Atoi(cfg.WriteConcern)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidWriteConcern, cfg.WriteConcern)
+		}
+		opts.SetWriteConcern(&writeconcern.WriteConcern{W: w})
+	}
+
+	if cfg.TxMaxCommitTimeMs > 0 {
+		maxCommitTime := time.Millisecond * time.Duration(cfg.TxMaxCommitTimeMs)
+		opts.SetMaxCommitTime(&maxCommitTime)
+	}
+	return opts, nil
+}
+
+// GetSession returns the session of the transaction from ctx or an error if there is no transaction.
+func GetSession(ctx context.Context) (mongo.Session, error) {
+	sess, ok := ctx.Value(TxKey).(mongo.Session)
+	if !ok {
+		return nil, fmt.Errorf("get session: %w", ErrNoTxFound)
+	}
+	return sess, nil
+}
+
+// WithTransaction runs fn in a multi-document transaction, committing it if fn succeeds
+// and aborting it if fn returns an error or panics.
+// The session is stored in the context passed to fn,
+// so all Mongo methods called with it participate in the transaction, see GetSession.
+//
+// The transaction is retried on errors labelled TransientTransactionError and the commit is retried
+// on UnknownTransactionCommitResult with a backoff until the retry timeout from Config expires or ctx is done.
+// opts override read and write concerns from Config.
+//
+// If ctx already holds a transaction, fn runs in it, because MongoDB doesn't support nested transactions.
+func (m Mongo) WithTransaction(
+	ctx context.Context,
+	fn func(ctx context.Context) error,
+	opts ...*options.TransactionOptions,
+) error {
+	if _, err := GetSession(ctx); err == nil {
+		return fn(ctx)
+	}
+
+	ctx, span := m.trace(ctx, "Mongo.WithTransaction")
+	defer span.End()
+
+	sess, err := m.mongo.StartSession()
+	if err != nil {
+		desc := "failed to start session"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, desc)
+		return fmt.Errorf("%s: %w", desc, err)
+	}
+	defer sess.EndSession(context.WithoutCancel(ctx))
+
+	txOpts := options.MergeTransactionOptions(append([]*options.TransactionOptions{m.txOpts}, opts...)...)
+	deadline := time.Now().Add(m.txRetryTimeout)
+
+	for attempt := 1; ; attempt++ {
+		err = m.runTransaction(ctx, sess, txOpts, attempt, deadline, fn)
+		if err == nil {
+			return nil
+		}
+		if !hasErrorLabel(err, labelTransientTransactionError) || time.Now().After(deadline) || ctx.Err() != nil {
+			desc := "transaction failed"
+			span.RecordError(err)
+			span.SetStatus(codes.Error, desc)
+			return fmt.Errorf("%s after %d attempts: %w", desc, attempt, err)
+		}
+	}
+}
+
+// runTransaction makes a single attempt to run fn in a transaction of sess.
+func (m Mongo) runTransaction(
+	ctx context.Context,
+	sess mongo.Session,
+	opts *options.TransactionOptions,
+	attempt int,
+	deadline time.Time,
+	fn func(ctx context.Context) error,
+) (err error) {
+	ctx, span := m.trace(ctx, "Mongo.WithTransaction.Attempt", attribute.Int("attempt", attempt))
+	ctx = mongo.NewSessionContext(context.WithValue(ctx, TxKey, sess), sess)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "transaction attempt failed")
+		}
+		span.End()
+	}()
+
+	if err = sess.StartTransaction(opts); err != nil {
+		return fmt.Errorf("start transaction: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = sess.AbortTransaction(context.WithoutCancel(ctx))
+			panic(p)
+		}
+	}()
+
+	if err = fn(ctx); err != nil {
+		// abort fails if fn has already ended the transaction, fn error is more relevant anyway
+		_ = sess.AbortTransaction(context.WithoutCancel(ctx))
+		return err
+	}
+
+	if ctx.Err() != nil {
+		_ = sess.AbortTransaction(context.WithoutCancel(ctx))
+		return fmt.Errorf("commit transaction: %w", ctx.Err())
+	}
+
+	for commitAttempt := 1; ; commitAttempt++ {
+		// commit isn't canceled with ctx, aborting after a failed commit may run concurrently with it
+		err = sess.CommitTransaction(context.WithoutCancel(ctx))
+		if err == nil {
+			return nil
+		}
+
+		var cmdErr mongo.CommandError
+		retryCommit := hasErrorLabel(err, labelUnknownTransactionCommitResult) &&
+			!(errors.As(err, &cmdErr) && cmdErr.IsMaxTimeMSExpiredError())
+		if !retryCommit || time.Now().After(deadline) {
+			return fmt.Errorf("commit transaction: %w", err)
+		}
+
+		// the commit result is unknown, so the transaction is left to the server when ctx is done
+		timer := time.NewTimer(commitBackoff(commitAttempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("wait for commit retry: %w", errors.Join(ctx.Err(), err))
+		case <-timer.C:
+		}
+	}
+}
+
+// commitBackoff returns the delay before retrying a commit after the given attempt,
+// doubling it on every attempt up to a second with full jitter.
+func commitBackoff(attempt int) time.Duration {
+	delay := commitBackoffBase
+	for i := 1; i < attempt && delay < commitBackoffMax; i++ {
+		delay *= 2
+	}
+	delay = min(delay, commitBackoffMax)
+	return rand.N(delay) + 1 //nolint:gosec // jitter doesn't need crypto rand
+}
+
+// hasErrorLabel reports whether err has the label set by the server or the driver.
+func hasErrorLabel(err error, label string) bool {
+	var labeled mongo.LabeledError
+	return errors.As(err, &labeled) && labeled.HasErrorLabel(label)
+}
+
+func (m Mongo) trace(ctx context.Context, spanName string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if m.tracer == nil {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+
+	ctx, span := m.tracer.Start(ctx, spanName, trace.WithAttributes(attrs...))
+	return ctx, span
+}
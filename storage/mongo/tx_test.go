@@ -0,0 +1,15 @@
+package mongo
+
+import "testing"
+
+func TestCommitBackoff(t *testing.T) {
+	for attempt := 1; attempt <= 20; attempt++ {
+		delay := commitBackoff(attempt)
+		if delay <= 0 || delay > commitBackoffMax {
+			t.Errorf("commitBackoff(%d) = %s, want in (0, %s]", attempt, delay, commitBackoffMax)
+		}
+		if attempt == 1 && delay > commitBackoffBase {
+			t.Errorf("commitBackoff(1) = %s, want at most %s", delay, commitBackoffBase)
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/yogenyslav/pkg/storage"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+const (
+	defaultWatchRetryDelay   = time.Second
+	defaultResumeTokenColl   = "resume_tokens"
+	defaultResumeTokenPrefix = "mongo:resume_token:"
+
+	// codeChangeStreamFatalError and codeChangeStreamHistoryLost are server errors a stream can't be resumed after.
+	codeChangeStreamFatalError  = 280
+	codeChangeStreamHistoryLost = 286
+)
+
+// ErrNoStreamID is an error when a resume token store is set for a watch without a stream id.
+var ErrNoStreamID = errors.New("stream id is required to store resume tokens")
+
+// ChangeEvent is a change stream event.
+type ChangeEvent struct {
+	// ResumeToken is the token of the event, the stream is resumed after it.
+	ResumeToken bson.Raw `bson:"_id"`
+	// OperationType is insert, update, replace, delete, drop, rename, dropDatabase or invalidate.
+	OperationType string              `bson:"operationType"`
+	ClusterTime   primitive.Timestamp `bson:"clusterTime"`
+	Namespace     struct {
+		DB   string `bson:"db"`
+		Coll string `bson:"coll"`
+	} `bson:"ns"`
+	// DocumentKey holds _id of the changed document.
+	DocumentKey bson.Raw `bson:"documentKey"`
+	// FullDocument is set for inserts and replaces, and for updates if WatchConfig.FullDocument requests it.
+	FullDocument bson.Raw `bson:"fullDocument"`
+	// FullDocumentBeforeChange is set if WatchConfig.FullDocumentBeforeChange requests it.
+	FullDocumentBeforeChange bson.Raw `bson:"fullDocumentBeforeChange"`
+	UpdateDescription        *struct {
+		UpdatedFields bson.Raw `bson:"updatedFields"`
+		RemovedFields []string `bson:"removedFields"`
+	} `bson:"updateDescription"`
+}
+
+// Decode decodes the full document of the event into dest.
+func (e ChangeEvent) Decode(dest interface{}) error {
+	if e.FullDocument == nil {
+		return fmt.Errorf("decode %s event: %w", e.OperationType, mongo.ErrNilDocument)
+	}
+	if err := bson.Unmarshal(e.FullDocument, dest); err != nil {
+		return fmt.Errorf("decode %s event: %w", e.OperationType, err)
+	}
+	return nil
+}
+
+// ChangeHandler handles change events. A returned error stops the watch without storing the event resume token,
+// so the event is delivered again when the watch is restarted.
+type ChangeHandler func(ctx context.Context, event ChangeEvent) error
+
+// ResumeTokenStore persists resume tokens of change streams.
+type ResumeTokenStore interface {
+	// Load returns the last saved token of the stream or nil if there is none.
+	Load(ctx context.Context, streamID string) (bson.Raw, error)
+	// Save saves the token of the stream.
+	Save(ctx context.Context, streamID string, token bson.Raw) error
+}
+
+// WatchConfig is the configuration for a change stream, defaults are used for zero values.
+type WatchConfig struct {
+	// ID identifies the stream in Store.
+	ID string
+	// Collection is a watched collection, the whole database is watched if empty.
+	Collection string
+	// Deployment watches all databases instead of the database from Config, Collection is ignored.
+	Deployment bool
+	// Pipeline filters and transforms events, e.g. mongo.Pipeline{{{"$match", ...}}}.
+	Pipeline interface{}
+	// FullDocument requests full documents for update events.
+	FullDocument options.FullDocument
+	// FullDocumentBeforeChange requests documents before the change, it must be enabled for the collection.
+	FullDocumentBeforeChange options.FullDocument
+	// Store persists resume tokens, the stream starts from now on every Watch call if nil.
+	Store ResumeTokenStore
+	// RetryDelay is a delay before the stream is reopened after an error, 1 second by default.
+	RetryDelay time.Duration
+}
+
+// Watch delivers change events of a collection, the database or the whole deployment to handler
+// until ctx is canceled or handler fails.
+// After every successful handler call the resume token is saved to cfg.Store, and the stream is resumed
+// from the last saved token when Watch starts and after transient errors.
+func (m Mongo) Watch(ctx context.Context, cfg WatchConfig, handler ChangeHandler) error {
+	if cfg.Store != nil && cfg.ID == "" {
+		return ErrNoStreamID
+	}
+	if cfg.RetryDelay <= 0 {
+		cfg.RetryDelay = defaultWatchRetryDelay
+	}
+	if cfg.Pipeline == nil {
+		cfg.Pipeline = mongo.Pipeline{}
+	}
+
+	var token bson.Raw
+	if cfg.Store != nil {
+		var err error
+		if token, err = cfg.Store.Load(ctx, cfg.ID); err != nil {
+			return fmt.Errorf("load resume token: %w", err)
+		}
+	}
+
+	for {
+		var err error
+		token, err = m.watch(ctx, cfg, token, handler)
+		if ctx.Err() != nil {
+			// canceled watch is a normal shutdown
+			return nil
+		}
+		if !isResumable(err) {
+			return err
+		}
+
+		timer := time.NewTimer(cfg.RetryDelay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+	}
+}
+
+// watch opens a stream after token and delivers events until an error, returns the last handled token.
+func (m Mongo) watch(
+	ctx context.Context,
+	cfg WatchConfig,
+	token bson.Raw,
+	handler ChangeHandler,
+) (bson.Raw, error) {
+	opts := options.ChangeStream()
+	if cfg.FullDocument != "" {
+		opts.SetFullDocument(cfg.FullDocument)
+	}
+	if cfg.FullDocumentBeforeChange != "" {
+		opts.SetFullDocumentBeforeChange(cfg.FullDocumentBeforeChange)
+	}
+	if token != nil {
+		// unlike resumeAfter, startAfter also works after an invalidate event
+		opts.SetStartAfter(token)
+	}
+
+	var (
+		stream *mongo.ChangeStream
+		err    error
+	)
+	switch {
+	case cfg.Deployment:
+		stream, err = m.mongo.Watch(ctx, cfg.Pipeline, opts)
+	case cfg.Collection == "":
+		stream, err = m.mongo.Database(m.db).Watch(ctx, cfg.Pipeline, opts)
+	default:
+		stream, err = m.mongo.Database(m.db).Collection(cfg.Collection).Watch(ctx, cfg.Pipeline, opts)
+	}
+	if err != nil {
+		return token, fmt.Errorf("failed to open change stream: %w", err)
+	}
+	defer stream.Close(context.WithoutCancel(ctx))
+
+	for stream.Next(ctx) {
+		var event ChangeEvent
+		if err = stream.Decode(&event); err != nil {
+			return token, fmt.Errorf("failed to decode change event: %w", err)
+		}
+
+		if err = m.handleChange(ctx, cfg, event, handler); err != nil {
+			return token, &handlerError{err: err}
+		}
+
+		token = stream.ResumeToken()
+		if cfg.Store != nil {
+			if err = cfg.Store.Save(ctx, cfg.ID, token); err != nil {
+				return token, fmt.Errorf("save resume token: %w", err)
+			}
+		}
+	}
+
+	if err = stream.Err(); err != nil {
+		return token, fmt.Errorf("change stream failed: %w", err)
+	}
+	// the stream is closed after an invalidate event
+	return token, nil
+}
+
+// handleChange calls handler for event in its own span.
+func (m Mongo) handleChange(ctx context.Context, cfg WatchConfig, event ChangeEvent, handler ChangeHandler) error {
+	ctx, span := m.trace(
+		ctx,
+		"Mongo.Watch.Event",
+		attribute.String("stream", cfg.ID),
+		attribute.String("operation", event.OperationType),
+		attribute.String("collection", event.Namespace.Coll),
+	)
+	defer span.End()
+
+	if err := handler(ctx, event); err != nil {
+		desc := "failed to handle change event"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, desc)
+		return fmt.Errorf("%s: %w", desc, err)
+	}
+	return nil
+}
+
+// handlerError marks errors returned by a ChangeHandler, they stop the watch.
+type handlerError struct {
+	err error
+}
+
+func (e *handlerError) Error() string {
+	return e.err.Error()
+}
+
+func (e *handlerError) Unwrap() error {
+	return e.err
+}
+
+// isResumable reports whether the stream may be reopened after err.
+func isResumable(err error) bool {
+	var hErr *handlerError
+	if errors.As(err, &hErr) {
+		return false
+	}
+
+	var srvErr mongo.ServerError
+	if errors.As(err, &srvErr) {
+		return !srvErr.HasErrorCode(codeChangeStreamFatalError) && !srvErr.HasErrorCode(codeChangeStreamHistoryLost)
+	}
+	return true
+}
+
+// CollectionTokenStore stores resume tokens in a Mongo collection, one document per stream.
+type CollectionTokenStore struct {
+	m    Mongo
+	coll string
+}
+
+// NewCollectionTokenStore creates a new CollectionTokenStore, tokens are stored in "resume_tokens" if coll is empty.
+func NewCollectionTokenStore(m Mongo, coll string) CollectionTokenStore {
+	if coll == "" {
+		coll = defaultResumeTokenColl
+	}
+	return CollectionTokenStore{m: m, coll: coll}
+}
+
+// Load implements ResumeTokenStore.
+func (s CollectionTokenStore) Load(ctx context.Context, streamID string) (bson.Raw, error) {
+	var doc struct {
+		Token bson.Raw `bson:"token"`
+	}
+	err := s.m.FindOne(ctx, s.coll, bson.D{{Key: "_id", Value: streamID}}, &doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return doc.Token, nil
+}
+
+// Save implements ResumeTokenStore.
+func (s CollectionTokenStore) Save(ctx context.Context, streamID string, token bson.Raw) error {
+	_, err := s.m.UpsertOne(
+		ctx,
+		s.coll,
+		bson.D{{Key: "_id", Value: streamID}},
+		bson.D{{Key: "$set", Value: bson.D{{Key: "token", Value: token}, {Key: "updated_at", Value: time.Now()}}}},
+	)
+	return err
+}
+
+// CacheTokenStore stores resume tokens in a storage.Cache.
+type CacheTokenStore struct {
+	cache  storage.Cache
+	prefix string
+	exp    time.Duration
+}
+
+// NewCacheTokenStore creates a new CacheTokenStore, tokens are stored with prefix prepended to stream ids
+// and expire after exp if it's not zero. "mongo:resume_token:" is used if prefix is empty.
+func NewCacheTokenStore(cache storage.Cache, prefix string, exp time.Duration) CacheTokenStore {
+	if prefix == "" {
+		prefix = defaultResumeTokenPrefix
+	}
+	return CacheTokenStore{cache: cache, prefix: prefix, exp: exp}
+}
+
+// Load implements ResumeTokenStore.
+func (s CacheTokenStore) Load(ctx context.Context, streamID string) (bson.Raw, error) {
+	token, err := s.cache.GetBytes(ctx, s.prefix+streamID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get resume token from cache: %w", err)
+	}
+	return token, nil
+}
+
+// Save implements ResumeTokenStore.
+func (s CacheTokenStore) Save(ctx context.Context, streamID string, token bson.Raw) error {
+	if err := s.cache.SetPrimitive(ctx, s.prefix+streamID, []byte(token), s.exp); err != nil {
+		return fmt.Errorf("set resume token in cache: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+	"github.com/rs/zerolog/log"
+	"github.com/yogenyslav/pkg/storage"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+const (
+	defaultAuditTable         = "audit_log"
+	defaultAuditPruneInterval = time.Hour
+
+	// auditActorSetting is a custom setting holding the actor for the current transaction.
+	auditActorSetting = "audit.actor"
+)
+
+// WithActor sets the actor recorded in the audit log for writes in transactions started with ctx, see WithAudit.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey, actor)
+}
+
+// Actor returns the actor set by WithActor.
+func Actor(ctx context.Context) (string, bool) {
+	actor, ok := ctx.Value(actorKey).(string)
+	return actor, ok && actor != ""
+}
+
+// setActorQuery sets the actor for the current transaction.
+const setActorQuery = "select set_config('" + auditActorSetting + "', $1, true)"
+
+// setActor sets the actor from ctx for tx, so audit triggers record it for all writes in tx.
+func (pg Postgres) setActor(ctx context.Context, tx pgx.Tx) error {
+	actor, ok := Actor(ctx)
+	if !pg.audit || !ok {
+		return nil
+	}
+
+	if _, err := tx.Exec(ctx, setActorQuery, actor); err != nil {
+		return fmt.Errorf("set audit actor: %w", Classify(err))
+	}
+	return nil
+}
+
+// AuditEntry is a change of a single row recorded in the audit log.
+type AuditEntry struct {
+	ID         int64     `db:"id" json:"id"`
+	OccurredAt time.Time `db:"occurred_at" json:"occurred_at"`
+	// Actor is an actor set by WithActor, empty if there was none.
+	Actor string `db:"actor" json:"actor"`
+	// Operation is INSERT, UPDATE or DELETE.
+	Operation string `db:"operation" json:"operation"`
+	Schema    string `db:"table_schema" json:"schema"`
+	Table     string `db:"table_name" json:"table"`
+	// PK is the primary key of the changed row as text.
+	PK string `db:"row_pk" json:"pk"`
+	// Before is the row before the change, null for inserts.
+	Before json.RawMessage `db:"before" json:"before"`
+	// After is the row after the change, null for deletes.
+	After json.RawMessage `db:"after" json:"after"`
+}
+
+// AuditConfig is the configuration for the audit log, defaults are used for zero values.
+type AuditConfig struct {
+	// Table is a table for audit entries, "audit_log" by default.
+	Table string
+	// Retention is how long entries are kept by RunRetention, forever if zero.
+	Retention time.Duration
+	// PruneInterval is how often RunRetention prunes entries, 1 hour by default.
+	PruneInterval time.Duration
+}
+
+// Auditor records changes of tracked tables into the audit log with triggers,
+// in the same transaction as the change itself.
+// Actors are recorded only for transactions of Postgres created with WithAudit.
+type Auditor struct {
+	pg    Postgres
+	cfg   AuditConfig
+	table string
+}
+
+// NewAuditor creates a new Auditor.
+func NewAuditor(pg Postgres, cfg AuditConfig) *Auditor {
+	if cfg.Table == "" {
+		cfg.Table = defaultAuditTable
+	}
+	if cfg.PruneInterval <= 0 {
+		cfg.PruneInterval = defaultAuditPruneInterval
+	}
+
+	return &Auditor{
+		pg:    pg,
+		cfg:   cfg,
+		table: pgx.Identifier(strings.Split(cfg.Table, ".")).Sanitize(),
+	}
+}
+
+// captureFunc returns the name of the trigger function.
+func (a *Auditor) captureFunc() string {
+	parts := strings.Split(a.cfg.Table, ".")
+	parts[len(parts)-1] += "_capture"
+	return pgx.Identifier(parts).Sanitize()
+}
+
+// CreateTable creates the audit table, its indexes and the trigger function if they don't exist.
+func (a *Auditor) CreateTable(ctx context.Context) error {
+	ctx, span := a.pg.trace(ctx, "Auditor.CreateTable")
+	defer span.End()
+
+	indexPrefix := pgx.Identifier{strings.ReplaceAll(a.cfg.Table, ".", "_")}
+	_, err := a.pg.querier(ctx).Exec(ctx, `
+		create table if not exists `+a.table+` (
+			id bigserial primary key,
+			occurred_at timestamptz not null default now(),
+			actor text not null default '',
+			operation text not null,
+			table_schema text not null,
+			table_name text not null,
+			row_pk text not null,
+			before jsonb,
+			after jsonb
+		);
+		create index if not exists `+pgx.Identifier{indexPrefix[0] + "_row"}.Sanitize()+`
+			on `+a.table+` (table_name, row_pk, id);
+		create index if not exists `+pgx.Identifier{indexPrefix[0] + "_occurred_at"}.Sanitize()+`
+			on `+a.table+` (occurred_at);
+
+		create or replace function `+a.captureFunc()+`() returns trigger language plpgsql as $$
+		declare
+			row_before jsonb;
+			row_after jsonb;
+		begin
+			if tg_op <> 'INSERT' then
+				row_before := to_jsonb(old);
+			end if;
+			if tg_op <> 'DELETE' then
+				row_after := to_jsonb(new);
+			end if;
+
+			insert into `+a.table+` (actor, operation, table_schema, table_name, row_pk, before, after)
+			values (
+				coalesce(current_setting('`+auditActorSetting+`', true), ''),
+				tg_op,
+				tg_table_schema,
+				tg_table_name,
+				coalesce(row_after, row_before) ->> tg_argv[0],
+				row_before,
+				row_after
+			);
+			return null;
+		end
+		$$;
+	`)
+	if err != nil {
+		desc := "failed to create audit table"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, desc)
+		return fmt.Errorf("%s: %w", desc, Classify(err))
+	}
+	return nil
+}
+
+// Track installs the audit trigger on table, pkColumn identifies changed rows in the history.
+// It's safe to call Track for an already tracked table.
+func (a *Auditor) Track(ctx context.Context, table, pkColumn string) error {
+	ctx, span := a.pg.trace(ctx, "Auditor.Track", attribute.String("table", table))
+	defer span.End()
+
+	tableIdent := pgx.Identifier(strings.Split(table, "."))
+	trigger := pgx.Identifier{strings.ReplaceAll(a.cfg.Table, ".", "_")}.Sanitize()
+
+	err := a.pg.WithTx(ctx, storage.TxOptions{}, func(ctx context.Context) error {
+		_, err := a.pg.querier(ctx).Exec(ctx, `
+			drop trigger if exists `+trigger+` on `+tableIdent.Sanitize()+`;
+			create trigger `+trigger+`
+				after insert or update or delete on `+tableIdent.Sanitize()+`
+				for each row execute function `+a.captureFunc()+`(`+quoteLiteral(pkColumn)+`);
+		`)
+		return err
+	})
+	if err != nil {
+		desc := "failed to track table"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, desc)
+		return fmt.Errorf("%s %s: %w", desc, table, err)
+	}
+	return nil
+}
+
+// Untrack removes the audit trigger from table, recorded history is kept.
+func (a *Auditor) Untrack(ctx context.Context, table string) error {
+	ctx, span := a.pg.trace(ctx, "Auditor.Untrack", attribute.String("table", table))
+	defer span.End()
+
+	trigger := pgx.Identifier{strings.ReplaceAll(a.cfg.Table, ".", "_")}.Sanitize()
+	_, err := a.pg.querier(ctx).Exec(
+		ctx,
+		"drop trigger if exists "+trigger+" on "+pgx.Identifier(strings.Split(table, ".")).Sanitize(),
+	)
+	if err != nil {
+		desc := "failed to untrack table"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, desc)
+		return fmt.Errorf("%s %s: %w", desc, table, Classify(err))
+	}
+	return nil
+}
+
+// History returns changes of the row of table with the primary key pk, from the oldest to the newest.
+// Table may be qualified with a schema.
+func (a *Auditor) History(ctx context.Context, table string, pk any) ([]AuditEntry, error) {
+	ctx, span := a.pg.trace(ctx, "Auditor.History", attribute.String("table", table))
+	defer span.End()
+
+	schema, name, qualified := strings.Cut(table, ".")
+	if !qualified {
+		schema, name = "", table
+	}
+
+	var entries []AuditEntry
+	err := pgxscan.Select(ctx, a.pg.querier(ctx), &entries, `
+		select id, occurred_at, actor, operation, table_schema, table_name, row_pk, before, after
+		from `+a.table+`
+		where table_name = $1 and row_pk = $2 and ($3 = '' or table_schema = $3)
+		order by id`,
+		name, fmt.Sprint(pk), schema,
+	)
+	if err != nil {
+		desc := "failed to get audit history"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, desc)
+		return nil, fmt.Errorf("%s: %w", desc, Classify(err))
+	}
+	return entries, nil
+}
+
+// Prune deletes entries older than olderThan, returns number of deleted entries.
+func (a *Auditor) Prune(ctx context.Context, olderThan time.Duration) (int64, error) {
+	ctx, span := a.pg.trace(ctx, "Auditor.Prune")
+	defer span.End()
+
+	tag, err := a.pg.querier(ctx).Exec(
+		ctx,
+		"delete from "+a.table+" where occurred_at < $1",
+		time.Now().Add(-olderThan),
+	)
+	if err != nil {
+		desc := "failed to prune audit log"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, desc)
+		return 0, fmt.Errorf("%s: %w", desc, Classify(err))
+	}
+
+	span.SetAttributes(attribute.Int64("deleted", tag.RowsAffected()))
+	return tag.RowsAffected(), nil
+}
+
+// RunRetention prunes entries older than AuditConfig.Retention every AuditConfig.PruneInterval
+// until ctx is canceled. It returns immediately if retention isn't configured.
+func (a *Auditor) RunRetention(ctx context.Context) {
+	if a.cfg.Retention <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(a.cfg.PruneInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := a.Prune(ctx, a.cfg.Retention); err != nil && ctx.Err() == nil {
+			log.Err(err).Str("table", a.cfg.Table).Msg("audit log retention failed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// quoteLiteral quotes s as an SQL string literal.
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
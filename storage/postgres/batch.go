@@ -0,0 +1,153 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrBatchAborted is an error for batch statements that weren't executed because a previous statement failed.
+var ErrBatchAborted = errors.New("batch aborted by previous statement")
+
+// BatchStatementError is an error of a single statement in a batch.
+type BatchStatementError struct {
+	Index int
+	Query string
+	Err   error
+}
+
+// Error implements error interface.
+func (e *BatchStatementError) Error() string {
+	return fmt.Sprintf("batch statement %d: %s", e.Index, e.Err)
+}
+
+// Unwrap returns the underlying statement error.
+func (e *BatchStatementError) Unwrap() error {
+	return e.Err
+}
+
+type batchItemKind uint8
+
+const (
+	batchExec batchItemKind = iota
+	batchQuery
+	batchQuerySlice
+)
+
+type batchItem struct {
+	kind  batchItemKind
+	query string
+	dest  any
+}
+
+// Batch queues statements to be sent to postgres in a single round trip with Postgres.SendBatch.
+// The zero value is ready to use. A Batch must only be sent once.
+type Batch struct {
+	batch pgx.Batch
+	items []batchItem
+}
+
+// Exec queues a statement that doesn't return any rows.
+func (b *Batch) Exec(query string, args ...any) {
+	b.queue(batchExec, nil, query, args...)
+}
+
+// Query queues a query that returns a single row, which is scanned into dest.
+func (b *Batch) Query(dest any, query string, args ...any) {
+	b.queue(batchQuery, dest, query, args...)
+}
+
+// QuerySlice queues a query that returns multiple rows, which are scanned into dest.
+func (b *Batch) QuerySlice(dest any, query string, args ...any) {
+	b.queue(batchQuerySlice, dest, query, args...)
+}
+
+// Len returns the number of queued statements.
+func (b *Batch) Len() int {
+	return len(b.items)
+}
+
+func (b *Batch) queue(kind batchItemKind, dest any, query string, args ...any) {
+	b.batch.Queue(query, args...)
+	b.items = append(b.items, batchItem{kind: kind, query: query, dest: dest})
+}
+
+// SendBatch sends all statements queued in b in a single round trip, in the transaction from ctx if there is one.
+// Statements are executed atomically: if one of them fails, none of them are applied.
+//
+// Returns number of affected rows for every statement in the order they were queued.
+// Failed statements are reported as *BatchStatementError.
+func (pg Postgres) SendBatch(ctx context.Context, b *Batch) ([]int64, error) {
+	ctx, span := pg.trace(ctx, "Postgres.SendBatch", attribute.Int("statements", b.Len()))
+	defer span.End()
+	ctx = pg.withMethod(ctx, "SendBatch")
+
+	markWrite(ctx)
+
+	results := pg.querier(ctx).SendBatch(ctx, &b.batch)
+
+	rowsAffected := make([]int64, len(b.items))
+	var errs []error
+	for idx, item := range b.items {
+		if len(errs) > 0 {
+			errs = append(errs, &BatchStatementError{Index: idx, Query: item.query, Err: ErrBatchAborted})
+			continue
+		}
+
+		n, err := readBatchItem(results, item)
+		if err != nil {
+			span.AddEvent("batch statement failed", trace.WithAttributes(
+				attribute.Int("index", idx),
+				attribute.String("query", item.query),
+				attribute.String("error", err.Error()),
+			))
+			errs = append(errs, &BatchStatementError{Index: idx, Query: item.query, Err: err})
+			continue
+		}
+		rowsAffected[idx] = n
+	}
+
+	if err := results.Close(); err != nil && len(errs) == 0 {
+		errs = append(errs, Classify(err))
+	}
+
+	if len(errs) > 0 {
+		err := errors.Join(errs...)
+		desc := "batch failed"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, desc)
+		return rowsAffected, fmt.Errorf("%s: %w", desc, err)
+	}
+	return rowsAffected, nil
+}
+
+// readBatchItem reads the result of the next statement in the batch.
+func readBatchItem(results pgx.BatchResults, item batchItem) (int64, error) {
+	switch item.kind {
+	case batchExec:
+		tag, err := results.Exec()
+		if err != nil {
+			return 0, fmt.Errorf("failed to exec: %w", Classify(err))
+		}
+		return tag.RowsAffected(), nil
+	case batchQuery:
+		rows, _ := results.Query()
+		if err := pgxscan.ScanOne(item.dest, rows); err != nil {
+			return 0, fmt.Errorf("failed to get row: %w", Classify(err))
+		}
+		return rows.CommandTag().RowsAffected(), nil
+	case batchQuerySlice:
+		rows, _ := results.Query()
+		if err := pgxscan.ScanAll(item.dest, rows); err != nil {
+			return 0, fmt.Errorf("failed to get rows: %w", Classify(err))
+		}
+		return rows.CommandTag().RowsAffected(), nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,105 @@
+package postgres
+
+import (
+	"reflect"
+	"strings"
+
+	"github.com/georgysavva/scany/v2/dbscan"
+)
+
+// structColumn is a struct field mapped to a table column.
+type structColumn struct {
+	name  string
+	index []int
+	typ   reflect.Type
+}
+
+// structColumns maps fields of struct type t to columns the same way scany does:
+// by "db" tag or snake cased field name, skipping unexported fields and fields tagged with "-".
+// Fields are visited breadth-first, so an outer field wins over an embedded field with the same column.
+// Embedded structs are flattened, a tag on an embedded struct prefixes its columns as "tag.column".
+// Unlike scany, other struct fields are only mapped as a single column, because each column holds one value.
+func structColumns(t reflect.Type) []structColumn {
+	type traversal struct {
+		typ    reflect.Type
+		index  []int
+		prefix string
+	}
+
+	var columns []structColumn
+	seen := make(map[string]struct{})
+
+	queue := []traversal{{typ: t}}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		for i := range current.typ.NumField() {
+			field := current.typ.Field(i)
+			if field.PkgPath != "" && !field.Anonymous {
+				continue
+			}
+
+			tag, hasTag := field.Tag.Lookup("db")
+			tag = strings.Split(tag, ",")[0]
+			if tag == "-" {
+				continue
+			}
+
+			index := append(append([]int{}, current.index...), field.Index...)
+
+			if field.Anonymous {
+				fieldType := field.Type
+				if fieldType.Kind() == reflect.Pointer {
+					fieldType = fieldType.Elem()
+				}
+				if fieldType.Kind() == reflect.Struct {
+					prefix := columnName(current.prefix, tag)
+					queue = append(queue, traversal{typ: fieldType, index: index, prefix: prefix})
+				}
+				continue
+			}
+
+			part := tag
+			if !hasTag {
+				part = dbscan.SnakeCaseMapper(field.Name)
+			}
+			name := columnName(current.prefix, part)
+			if _, ok := seen[name]; ok {
+				continue
+			}
+			seen[name] = struct{}{}
+			columns = append(columns, structColumn{name: name, index: index, typ: field.Type})
+		}
+	}
+
+	return columns
+}
+
+// columnName joins non-empty parts of a column name with dots like scany does.
+func columnName(parts ...string) string {
+	nonEmpty := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+	return strings.Join(nonEmpty, ".")
+}
+
+// value returns the value of the column in struct v or nil if it's behind a nil embedded pointer.
+func (c structColumn) value(v reflect.Value) any {
+	field, err := v.FieldByIndexErr(c.index)
+	if err != nil {
+		return nil
+	}
+	return field.Interface()
+}
+
+// structType returns the struct type behind t and reports whether t is a struct or a pointer to a struct.
+func structType(t reflect.Type) (reflect.Type, bool) {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t, t.Kind() == reflect.Struct
+}
@@ -1,33 +1,136 @@
 package postgres
 
 import (
+	"errors"
 	"fmt"
 	"net"
+	"net/url"
 )
 
+// ErrInvalidSslMode is an error when Config.SslMode isn't one of the libpq sslmode values.
+var ErrInvalidSslMode = errors.New("invalid ssl mode")
+
 // Config is the configuration for the PostgreSQL client.
 type Config struct {
-	User         string `yaml:"user"`
-	Password     string `yaml:"password"`
-	Host         string `yaml:"host"`
-	DB           string `yaml:"db"`
-	Ssl          bool   `yaml:"ssl"`
-	Port         string `yaml:"port"`
-	RetryTimeout int    `yaml:"retry_timeout"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	Host     string `yaml:"host"`
+	DB       string `yaml:"db"`
+	// Ssl enables sslmode=require when SslMode is empty.
+	//
+	// Deprecated: use SslMode.
+	Ssl bool `yaml:"ssl"`
+	// SslMode is a libpq sslmode: disable, allow, prefer, require, verify-ca or verify-full.
+	// New returns ErrInvalidSslMode for other values.
+	SslMode string `yaml:"ssl_mode"`
+	// SslRootCert is a path to the CA certificate used to verify the server.
+	SslRootCert string `yaml:"ssl_root_cert"`
+	// SslCert is a path to the client certificate.
+	SslCert string `yaml:"ssl_cert"`
+	// SslKey is a path to the client certificate key.
+	SslKey          string `yaml:"ssl_key"`
+	Port            string `yaml:"port"`
+	RetryTimeout    int    `yaml:"retry_timeout"`
+	ApplicationName string `yaml:"application_name"`
+	// StatementTimeoutMs is a default statement_timeout for every connection, server default if zero.
+	StatementTimeoutMs int `yaml:"statement_timeout_ms"`
+	// SearchPath is a default search_path for every connection, server default if empty.
+	SearchPath string     `yaml:"search_path"`
+	Pool       PoolConfig `yaml:"pool"`
+	// Replicas are read replicas of the primary, they share credentials and settings with it.
+	Replicas []ReplicaConfig `yaml:"replicas"`
+	// ReplicaBalancer selects a replica for a read: round_robin (default) or least_conns.
+	ReplicaBalancer string `yaml:"replica_balancer"`
+	// ReplicaHealthCheckSec is a period of replica health checks, 5 seconds if zero.
+	ReplicaHealthCheckSec int `yaml:"replica_health_check_sec"`
+	// Tracing configures spans and slow query logs produced by pgx for every query.
+	Tracing TracingConfig `yaml:"tracing"`
+	// Tenancy configures schema-per-tenant isolation, see WithTenant.
+	Tenancy TenancyConfig `yaml:"tenancy"`
+	// MetricsPool is the pool label of the primary in Metrics, db@host:port by default.
+	// Replicas are labelled with it followed by their host:port.
+	MetricsPool string `yaml:"metrics_pool"`
+}
+
+// metricsPool returns the pool label of the primary in Metrics.
+func (cfg *Config) metricsPool() string {
+	if cfg.MetricsPool != "" {
+		return cfg.MetricsPool
+	}
+	return cfg.DB + "@" + net.JoinHostPort(cfg.Host, cfg.Port)
+}
+
+// ReplicaConfig is the configuration for a read replica.
+type ReplicaConfig struct {
+	Host string `yaml:"host"`
+	Port string `yaml:"port"`
+}
+
+// PoolConfig is the configuration for the connection pool, pgxpool defaults are used for zero values.
+type PoolConfig struct {
+	MaxConns             int32 `yaml:"max_conns"`
+	MinConns             int32 `yaml:"min_conns"`
+	MaxConnLifetimeSec   int   `yaml:"max_conn_lifetime_sec"`
+	MaxConnIdleTimeSec   int   `yaml:"max_conn_idle_time_sec"`
+	HealthCheckPeriodSec int   `yaml:"health_check_period_sec"`
 }
 
 // URL assembles config values into a conn string.
 func (cfg *Config) URL() string {
-	sslMode := "disable"
-	if cfg.Ssl {
-		sslMode = "enable"
-	}
-	return fmt.Sprintf(
-		"postgresql://%s:%s@%s/%s?sslmode=%s",
-		cfg.User,
-		cfg.Password,
-		net.JoinHostPort(cfg.Host, cfg.Port),
-		cfg.DB,
-		sslMode,
-	)
+	params := url.Values{}
+	params.Set("sslmode", cfg.sslMode())
+	if cfg.SslRootCert != "" {
+		params.Set("sslrootcert", cfg.SslRootCert)
+	}
+	if cfg.SslCert != "" {
+		params.Set("sslcert", cfg.SslCert)
+	}
+	if cfg.SslKey != "" {
+		params.Set("sslkey", cfg.SslKey)
+	}
+	if cfg.ApplicationName != "" {
+		params.Set("application_name", cfg.ApplicationName)
+	}
+
+	u := url.URL{
+		Scheme:   "postgresql",
+		User:     url.UserPassword(cfg.User, cfg.Password),
+		Host:     net.JoinHostPort(cfg.Host, cfg.Port),
+		Path:     cfg.DB,
+		RawQuery: params.Encode(),
+	}
+	return u.String()
+}
+
+// replicaURL returns a conn string for the replica.
+func (cfg *Config) replicaURL(replica ReplicaConfig) string {
+	replicaCfg := *cfg
+	replicaCfg.Host = replica.Host
+	replicaCfg.Port = replica.Port
+	return replicaCfg.URL()
+}
+
+// validate checks values that would otherwise only fail with a vague error when connecting.
+func (cfg *Config) validate() error {
+	switch cfg.sslMode() {
+	case "disable", "allow", "prefer", "require", "verify-ca", "verify-full":
+		return nil
+	default:
+		return fmt.Errorf(
+			"%w: %q, must be disable, allow, prefer, require, verify-ca or verify-full",
+			ErrInvalidSslMode,
+			cfg.SslMode,
+		)
+	}
+}
+
+func (cfg *Config) sslMode() string {
+	switch {
+	case cfg.SslMode != "":
+		return cfg.SslMode
+	case cfg.Ssl:
+		return "require"
+	default:
+		return "disable"
+	}
 }
@@ -0,0 +1,15 @@
+package postgres_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/yogenyslav/pkg/storage/postgres"
+)
+
+func TestNewRejectsInvalidSslMode(t *testing.T) {
+	cfg := &postgres.Config{Host: "localhost", Port: "5432", SslMode: "requried"}
+	if _, err := postgres.New(cfg, nil); !errors.Is(err, postgres.ErrInvalidSslMode) {
+		t.Errorf("New() error = %v, want %v", err, postgres.ErrInvalidSslMode)
+	}
+}
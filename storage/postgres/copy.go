@@ -0,0 +1,125 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+var (
+	// ErrNotStructSlice is an error when rows passed to CopyFromSlice aren't a slice of structs.
+	ErrNotStructSlice = errors.New("rows must be a slice of structs or pointers to structs")
+	// ErrNilRow is an error when a slice passed to CopyFromSlice contains a nil pointer.
+	ErrNilRow = errors.New("row is nil")
+)
+
+// CopyFrom copies rows from src into table using the COPY protocol,
+// in the transaction from ctx if there is one. table may be qualified with a schema.
+//
+// Returns number of copied rows.
+func (pg Postgres) CopyFrom(
+	ctx context.Context,
+	table string,
+	columns []string,
+	src pgx.CopyFromSource,
+) (int64, error) {
+	ctx, span := pg.trace(
+		ctx,
+		"Postgres.CopyFrom",
+		attribute.String("table", table),
+		attribute.StringSlice("columns", columns),
+	)
+	defer span.End()
+	ctx = pg.withMethod(ctx, "CopyFrom")
+
+	markWrite(ctx)
+
+	n, err := pg.querier(ctx).CopyFrom(ctx, pgx.Identifier(strings.Split(table, ".")), columns, src)
+	if err != nil {
+		desc := "failed to copy rows"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, desc)
+		return 0, fmt.Errorf("%s: %w", desc, Classify(err))
+	}
+
+	span.SetAttributes(attribute.Int64("rows", n))
+	return n, nil
+}
+
+// CopyFromSlice copies a slice of structs into table using the COPY protocol,
+// in the transaction from ctx if there is one.
+// Columns are derived from struct fields the same way scany maps them when reading rows.
+//
+// Returns number of copied rows.
+func (pg Postgres) CopyFromSlice(ctx context.Context, table string, rows any) (int64, error) {
+	src, err := newStructCopySource(rows)
+	if err != nil {
+		return 0, fmt.Errorf("copy from slice: %w", err)
+	}
+
+	return pg.CopyFrom(ctx, table, src.columnNames(), src)
+}
+
+// structCopySource implements pgx.CopyFromSource over a slice of structs.
+type structCopySource struct {
+	rows    reflect.Value
+	columns []structColumn
+	idx     int
+}
+
+func newStructCopySource(rows any) (*structCopySource, error) {
+	v := reflect.ValueOf(rows)
+	if v.Kind() != reflect.Slice {
+		return nil, ErrNotStructSlice
+	}
+
+	t, ok := structType(v.Type().Elem())
+	if !ok {
+		return nil, ErrNotStructSlice
+	}
+
+	return &structCopySource{
+		rows:    v,
+		columns: structColumns(t),
+		idx:     -1,
+	}, nil
+}
+
+func (s *structCopySource) columnNames() []string {
+	names := make([]string, len(s.columns))
+	for i, column := range s.columns {
+		names[i] = column.name
+	}
+	return names
+}
+
+// Next implements pgx.CopyFromSource.
+func (s *structCopySource) Next() bool {
+	s.idx++
+	return s.idx < s.rows.Len()
+}
+
+// Values implements pgx.CopyFromSource.
+func (s *structCopySource) Values() ([]any, error) {
+	row := reflect.Indirect(s.rows.Index(s.idx))
+	if !row.IsValid() {
+		return nil, fmt.Errorf("row %d: %w", s.idx, ErrNilRow)
+	}
+
+	values := make([]any, len(s.columns))
+	for i, column := range s.columns {
+		values[i] = column.value(row)
+	}
+	return values, nil
+}
+
+// Err implements pgx.CopyFromSource.
+func (s *structCopySource) Err() error {
+	return nil
+}
@@ -0,0 +1,33 @@
+package postgres
+
+import (
+	"github.com/yogenyslav/pkg/storage/postgres/pgerr"
+)
+
+var (
+	// ErrUniqueViolation is an error when a unique constraint is violated.
+	ErrUniqueViolation = pgerr.ErrUniqueViolation
+	// ErrForeignKeyViolation is an error when a foreign key constraint is violated.
+	ErrForeignKeyViolation = pgerr.ErrForeignKeyViolation
+	// ErrNotNullViolation is an error when null is written into a not null column.
+	ErrNotNullViolation = pgerr.ErrNotNullViolation
+	// ErrCheckViolation is an error when a check constraint is violated.
+	ErrCheckViolation = pgerr.ErrCheckViolation
+	// ErrSerializationFailure is an error when a transaction can't be serialized and should be retried.
+	ErrSerializationFailure = pgerr.ErrSerializationFailure
+	// ErrDeadlock is an error when a transaction was aborted to resolve a deadlock.
+	ErrDeadlock = pgerr.ErrDeadlock
+	// ErrQueryCanceled is an error when a query was canceled by a timeout or a context cancellation.
+	ErrQueryCanceled = pgerr.ErrQueryCanceled
+	// ErrConnectionLost is an error when a connection to postgres was lost.
+	ErrConnectionLost = pgerr.ErrConnectionLost
+)
+
+// Error is a classified postgres error, see pgerr.Error.
+type Error = pgerr.Error
+
+// Classify wraps err into *Error if it's a known postgres error, otherwise err is returned as is.
+// All methods of Postgres return classified errors.
+func Classify(err error) error {
+	return pgerr.Classify(err)
+}
@@ -0,0 +1,133 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"iter"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+	"github.com/yogenyslav/pkg/storage"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Get executes a query that returns a single row and scans it into T,
+// in the transaction from ctx if there is one.
+func Get[T any](ctx context.Context, db storage.SQLDatabase, query string, args ...any) (T, error) {
+	var dest T
+
+	var err error
+	if _, txErr := db.GetTx(ctx); txErr == nil {
+		err = db.QueryTx(ctx, &dest, query, args...)
+	} else {
+		err = db.Query(ctx, &dest, query, args...)
+	}
+	return dest, err
+}
+
+// Select executes a query that returns multiple rows and scans them into a slice of T,
+// in the transaction from ctx if there is one.
+func Select[T any](ctx context.Context, db storage.SQLDatabase, query string, args ...any) ([]T, error) {
+	var dest []T
+
+	var err error
+	if _, txErr := db.GetTx(ctx); txErr == nil {
+		err = db.QuerySliceTx(ctx, &dest, query, args...)
+	} else {
+		err = db.QuerySlice(ctx, &dest, query, args...)
+	}
+	return dest, err
+}
+
+// Iterate executes a query that returns multiple rows and scans them into T one by one,
+// without loading the whole result set into memory. It runs in the transaction from ctx if there is one.
+//
+// Iteration stops after the first error. Rows are closed when the loop is finished or broken.
+func Iterate[T any](ctx context.Context, db storage.SQLDatabase, query string, args ...any) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+
+		rows, err := db.QueryRows(ctx, query, args...)
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var dest T
+			if err = rows.Scan(&dest); err != nil {
+				yield(zero, fmt.Errorf("failed to scan row: %w", err))
+				return
+			}
+			if !yield(dest, nil) {
+				return
+			}
+		}
+
+		if err = rows.Err(); err != nil {
+			yield(zero, fmt.Errorf("failed to get rows: %w", err))
+		}
+	}
+}
+
+// QueryRows executes a query that returns multiple rows to be scanned one by one with scany,
+// in the transaction from ctx if there is one. Otherwise it runs on a replica if there are any,
+// unless ctx requires the primary. Rows must be closed, the span of the query ends when they are.
+func (pg Postgres) QueryRows(ctx context.Context, query string, args ...any) (storage.Rows, error) {
+	ctx, span := pg.trace(ctx, "Postgres.QueryRows", attribute.String("query", query))
+	ctx = pg.withMethod(ctx, "QueryRows")
+
+	q := pg.querier(ctx)
+	if _, inTx := ctx.Value(TxKey).(pgx.Tx); !inTx {
+		q = pg.readQuerier(ctx)
+	}
+
+	rows, err := q.Query(ctx, query, args...)
+	if err != nil {
+		desc := "failed to get rows"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, desc)
+		span.End()
+		return nil, fmt.Errorf("%s: %w", desc, Classify(err))
+	}
+	return scanRows{rows: rows, scanner: pgxscan.NewRowScanner(rows), span: span}, nil
+}
+
+// scanRows implements storage.Rows scanning pgx rows with scany.
+type scanRows struct {
+	rows    pgx.Rows
+	scanner *pgxscan.RowScanner
+	span    trace.Span
+}
+
+func (r scanRows) Next() bool {
+	return r.rows.Next()
+}
+
+func (r scanRows) Scan(dest any) error {
+	if err := r.scanner.Scan(dest); err != nil {
+		desc := "failed to scan row"
+		r.span.RecordError(err)
+		r.span.SetStatus(codes.Error, desc)
+		return err
+	}
+	return nil
+}
+
+func (r scanRows) Err() error {
+	return Classify(r.rows.Err())
+}
+
+// Close closes the rows and ends the span of the query, recording the error occurred while reading rows.
+func (r scanRows) Close() {
+	r.rows.Close()
+	if err := r.rows.Err(); err != nil {
+		desc := "failed to get rows"
+		r.span.RecordError(err)
+		r.span.SetStatus(codes.Error, desc)
+	}
+	r.span.End()
+}
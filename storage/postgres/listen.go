@@ -0,0 +1,174 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+const (
+	listenBackoffBase = 100 * time.Millisecond
+	listenBackoffMax  = 10 * time.Second
+)
+
+// Notification is a message received from a postgres notification channel.
+type Notification struct {
+	// Channel is the name of the channel the notification was sent to.
+	Channel string
+	// Payload is the notification payload.
+	Payload string
+	// PID is the process id of the server session that sent the notification.
+	PID uint32
+}
+
+// NotificationHandler handles notifications received by ListenFunc.
+type NotificationHandler func(ctx context.Context, n Notification)
+
+// Listen subscribes to channels on a dedicated connection and delivers notifications to the returned channel.
+// After a connection loss, a new connection is acquired and LISTEN is issued again.
+// Notifications sent while reconnecting are lost.
+//
+// The returned channel is closed when ctx is canceled.
+// Channels are database-wide, so a tenant isn't required even if TenancyConfig.Required is set.
+func (pg Postgres) Listen(ctx context.Context, channels ...string) (<-chan Notification, error) {
+	conn, err := pg.subscribe(ctx, channels)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan Notification)
+	go func() {
+		defer close(out)
+		pg.listen(ctx, conn, channels, func(n Notification) {
+			select {
+			case out <- n:
+			case <-ctx.Done():
+			}
+		})
+	}()
+
+	return out, nil
+}
+
+// ListenFunc subscribes to channels on a dedicated connection and calls handler for every notification
+// until ctx is canceled. Reconnects the same way as Listen does.
+func (pg Postgres) ListenFunc(ctx context.Context, handler NotificationHandler, channels ...string) error {
+	conn, err := pg.subscribe(ctx, channels)
+	if err != nil {
+		return err
+	}
+
+	pg.listen(ctx, conn, channels, func(n Notification) {
+		handlerCtx, span := pg.trace(
+			ctx,
+			"Postgres.Notification",
+			attribute.String("channel", n.Channel),
+		)
+		defer span.End()
+
+		handler(handlerCtx, n)
+	})
+
+	return nil
+}
+
+// Notify sends a notification with payload to channel, in the transaction from ctx if there is one.
+// Inside a transaction the notification is delivered only after commit.
+func (pg Postgres) Notify(ctx context.Context, channel, payload string) error {
+	ctx, span := pg.trace(ctx, "Postgres.Notify", attribute.String("channel", channel))
+	defer span.End()
+
+	if _, err := pg.querier(ctx).Exec(ctx, "select pg_notify($1, $2)", channel, payload); err != nil {
+		desc := "failed to notify"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, desc)
+		return fmt.Errorf("%s: %w", desc, Classify(err))
+	}
+	return nil
+}
+
+// subscribe acquires a dedicated connection and issues LISTEN for every channel on it.
+func (pg Postgres) subscribe(ctx context.Context, channels []string) (*pgxpool.Conn, error) {
+	ctx, span := pg.trace(ctx, "Postgres.Listen", attribute.StringSlice("channels", channels))
+	defer span.End()
+
+	conn, err := pg.pool.Acquire(ctx)
+	if err != nil {
+		desc := "failed to acquire listen connection"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, desc)
+		return nil, fmt.Errorf("%s: %w", desc, Classify(err))
+	}
+
+	for _, channel := range channels {
+		if _, err = conn.Exec(ctx, "listen "+pgx.Identifier{channel}.Sanitize()); err != nil {
+			releaseListener(conn)
+
+			desc := "failed to listen"
+			span.RecordError(err)
+			span.SetStatus(codes.Error, desc)
+			return nil, fmt.Errorf("%s to channel %s: %w", desc, channel, Classify(err))
+		}
+	}
+
+	return conn, nil
+}
+
+// listen waits for notifications on conn and resubscribes after connection loss until ctx is canceled.
+func (pg Postgres) listen(ctx context.Context, conn *pgxpool.Conn, channels []string, deliver func(n Notification)) {
+	backoff := ExponentialBackoff(listenBackoffBase, listenBackoffMax)
+
+	for {
+		err := waitNotifications(ctx, conn, deliver)
+		releaseListener(conn)
+		if ctx.Err() != nil {
+			return
+		}
+
+		_, span := pg.trace(ctx, "Postgres.Listen.Reconnect", attribute.StringSlice("channels", channels))
+		span.RecordError(err)
+		span.End()
+
+		for attempt := 1; ; attempt++ {
+			timer := time.NewTimer(backoff(attempt))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+
+			if conn, err = pg.subscribe(ctx, channels); err == nil {
+				break
+			}
+		}
+	}
+}
+
+// waitNotifications delivers notifications received on conn until an error occurs.
+func waitNotifications(ctx context.Context, conn *pgxpool.Conn, deliver func(n Notification)) error {
+	for {
+		n, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("wait for notification: %w", Classify(err))
+		}
+
+		deliver(Notification{
+			Channel: n.Channel,
+			Payload: n.Payload,
+			PID:     n.PID,
+		})
+	}
+}
+
+// releaseListener closes the listening connection so that it's removed from the pool
+// instead of being reused with active subscriptions.
+func releaseListener(conn *pgxpool.Conn) {
+	_ = conn.Conn().Close(context.Background())
+	conn.Release()
+}
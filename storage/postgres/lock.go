@@ -0,0 +1,291 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+const defaultLeaderPeriod = 5 * time.Second
+
+// ErrLockNotHeld is an error when an advisory lock was already released.
+var ErrLockNotHeld = errors.New("advisory lock is not held")
+
+// LockKey hashes name into a key for postgres advisory lock functions.
+func LockKey(name string) int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(name))
+	return int64(h.Sum64()) //nolint:gosec // overflow is expected, any int64 is a valid key
+}
+
+// AdvisoryLock is a session-level advisory lock held on a dedicated connection until Unlock is called.
+type AdvisoryLock struct {
+	conn *pgxpool.Conn
+	name string
+	key  int64
+	mu   sync.Mutex
+}
+
+// Lock acquires a session-level advisory lock keyed by name, waiting until it's available or ctx is done.
+// Locks are database-wide, so a tenant isn't required even if TenancyConfig.Required is set.
+func (pg Postgres) Lock(ctx context.Context, name string) (*AdvisoryLock, error) {
+	ctx, span := pg.trace(ctx, "Postgres.Lock", attribute.String("lock", name))
+	defer span.End()
+
+	lock, _, err := pg.lock(ctx, name, "select true from pg_advisory_lock($1)")
+	if err != nil {
+		desc := "failed to acquire advisory lock"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, desc)
+		return nil, fmt.Errorf("%s %s: %w", desc, name, err)
+	}
+	return lock, nil
+}
+
+// TryLock acquires a session-level advisory lock keyed by name if it's available.
+// Returns nil lock and false if the lock is held by another session.
+func (pg Postgres) TryLock(ctx context.Context, name string) (*AdvisoryLock, bool, error) {
+	ctx, span := pg.trace(ctx, "Postgres.TryLock", attribute.String("lock", name))
+	defer span.End()
+
+	lock, acquired, err := pg.lock(ctx, name, "select pg_try_advisory_lock($1)")
+	if err != nil {
+		desc := "failed to try advisory lock"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, desc)
+		return nil, false, fmt.Errorf("%s %s: %w", desc, name, err)
+	}
+
+	span.SetAttributes(attribute.Bool("acquired", acquired))
+	return lock, acquired, nil
+}
+
+// LockTx acquires a transaction-level advisory lock keyed by name in the transaction from ctx,
+// waiting until it's available or ctx is done. The lock is released when the transaction ends.
+func (pg Postgres) LockTx(ctx context.Context, name string) error {
+	ctx, span := pg.trace(ctx, "Postgres.LockTx", attribute.String("lock", name))
+	defer span.End()
+
+	tx, err := pg.GetTx(ctx)
+	if err != nil {
+		return fmt.Errorf("get transaction: %w", err)
+	}
+
+	if _, err = tx.Exec(ctx, "select pg_advisory_xact_lock($1)", LockKey(name)); err != nil {
+		desc := "failed to acquire advisory lock in transaction"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, desc)
+		return fmt.Errorf("%s %s: %w", desc, name, Classify(err))
+	}
+	return nil
+}
+
+// TryLockTx acquires a transaction-level advisory lock keyed by name in the transaction from ctx if it's available.
+// The lock is released when the transaction ends.
+func (pg Postgres) TryLockTx(ctx context.Context, name string) (bool, error) {
+	ctx, span := pg.trace(ctx, "Postgres.TryLockTx", attribute.String("lock", name))
+	defer span.End()
+
+	tx, err := pg.GetTx(ctx)
+	if err != nil {
+		return false, fmt.Errorf("get transaction: %w", err)
+	}
+
+	var acquired bool
+	if err = tx.QueryRow(ctx, "select pg_try_advisory_xact_lock($1)", LockKey(name)).Scan(&acquired); err != nil {
+		desc := "failed to try advisory lock in transaction"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, desc)
+		return false, fmt.Errorf("%s %s: %w", desc, name, Classify(err))
+	}
+
+	span.SetAttributes(attribute.Bool("acquired", acquired))
+	return acquired, nil
+}
+
+// lock acquires a dedicated connection and runs a lock query on it, keeping the connection if the lock was acquired.
+func (pg Postgres) lock(ctx context.Context, name, query string) (*AdvisoryLock, bool, error) {
+	conn, err := pg.pool.Acquire(ctx)
+	if err != nil {
+		return nil, false, Classify(err)
+	}
+
+	key := LockKey(name)
+
+	var acquired bool
+	if err = conn.QueryRow(ctx, query, key).Scan(&acquired); err != nil {
+		conn.Release()
+		return nil, false, Classify(err)
+	}
+	if !acquired {
+		conn.Release()
+		return nil, false, nil
+	}
+
+	return &AdvisoryLock{conn: conn, name: name, key: key}, true, nil
+}
+
+// Unlock releases the lock and returns its connection to the pool.
+func (l *AdvisoryLock) Unlock(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn == nil {
+		return ErrLockNotHeld
+	}
+
+	conn := l.conn
+	l.conn = nil
+
+	if _, err := conn.Exec(ctx, "select pg_advisory_unlock($1)", l.key); err != nil {
+		// closing the session releases all its locks
+		_ = conn.Conn().Close(context.Background())
+		conn.Release()
+		return fmt.Errorf("failed to release advisory lock %s: %w", l.name, Classify(err))
+	}
+
+	conn.Release()
+	return nil
+}
+
+// Ping checks that the connection holding the lock is alive, so the lock is still held.
+func (l *AdvisoryLock) Ping(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.conn == nil {
+		return ErrLockNotHeld
+	}
+
+	if err := l.conn.Ping(ctx); err != nil {
+		return fmt.Errorf("ping advisory lock connection: %w", Classify(err))
+	}
+	return nil
+}
+
+// LeaderElectorOpt is an alias for leader elector options.
+type LeaderElectorOpt func(*LeaderElector)
+
+// WithRetryPeriod sets how often a follower tries to become a leader, 5 seconds by default.
+func WithRetryPeriod(period time.Duration) LeaderElectorOpt {
+	return func(le *LeaderElector) {
+		le.retryPeriod = period
+	}
+}
+
+// WithCheckPeriod sets how often a leader checks that it still holds the lock, 5 seconds by default.
+func WithCheckPeriod(period time.Duration) LeaderElectorOpt {
+	return func(le *LeaderElector) {
+		le.checkPeriod = period
+	}
+}
+
+// LeaderElector elects a single leader among replicas using a session-level advisory lock.
+type LeaderElector struct {
+	pg          Postgres
+	name        string
+	onElected   func(ctx context.Context)
+	onLost      func()
+	retryPeriod time.Duration
+	checkPeriod time.Duration
+	leader      atomic.Bool
+}
+
+// NewLeaderElector creates a new LeaderElector for the lock name.
+//
+// onElected is called in a separate goroutine after leadership is gained,
+// its ctx is canceled when leadership is lost. onLost is called after onElected returns. Both may be nil.
+func NewLeaderElector(
+	pg Postgres,
+	name string,
+	onElected func(ctx context.Context),
+	onLost func(),
+	opts ...LeaderElectorOpt,
+) *LeaderElector {
+	le := &LeaderElector{
+		pg:          pg,
+		name:        name,
+		onElected:   onElected,
+		onLost:      onLost,
+		retryPeriod: defaultLeaderPeriod,
+		checkPeriod: defaultLeaderPeriod,
+	}
+
+	for _, opt := range opts {
+		opt(le)
+	}
+
+	return le
+}
+
+// IsLeader reports whether this instance is the leader now.
+func (le *LeaderElector) IsLeader() bool {
+	return le.leader.Load()
+}
+
+// Run takes part in the election until ctx is canceled, releasing leadership on exit.
+func (le *LeaderElector) Run(ctx context.Context) {
+	for {
+		lock, acquired, err := le.pg.TryLock(ctx, le.name)
+		if err == nil && acquired {
+			le.lead(ctx, lock)
+		}
+
+		timer := time.NewTimer(le.retryPeriod)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// lead runs onElected while the lock is held and ctx isn't canceled.
+func (le *LeaderElector) lead(ctx context.Context, lock *AdvisoryLock) {
+	le.leader.Store(true)
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if le.onElected != nil {
+			le.onElected(leaderCtx)
+		}
+	}()
+
+	ticker := time.NewTicker(le.checkPeriod)
+	defer ticker.Stop()
+
+loop:
+	for {
+		select {
+		case <-ctx.Done():
+			break loop
+		case <-ticker.C:
+			if err := lock.Ping(ctx); err != nil {
+				break loop
+			}
+		}
+	}
+
+	le.leader.Store(false)
+	cancel()
+	<-done
+
+	unlockCtx, unlockCancel := context.WithTimeout(context.WithoutCancel(ctx), le.checkPeriod)
+	_ = lock.Unlock(unlockCtx)
+	unlockCancel()
+
+	if le.onLost != nil {
+		le.onLost()
+	}
+}
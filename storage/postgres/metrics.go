@@ -0,0 +1,206 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ErrDuplicatePoolLabel is an error when Postgres instances sharing Metrics have pools with the same label.
+var ErrDuplicatePoolLabel = errors.New("pool label is already used in metrics")
+
+// Metrics is a prometheus.Collector for pool stats, query durations and errors of Postgres.
+// Register it on any prometheus.Registerer and pass it to New with WithMetrics.
+// It may be shared by several Postgres instances, their pools are labelled by Config.MetricsPool.
+// Queries are labelled by the Postgres method that made them, e.g. Query, ExecTx or SendBatch,
+// and by the name set with WithQueryName.
+type Metrics struct {
+	mu    sync.RWMutex
+	pools map[string]*pgxpool.Pool
+
+	queryDuration *prometheus.HistogramVec
+	queryErrors   *prometheus.CounterVec
+
+	acquiredConns        *prometheus.Desc
+	idleConns            *prometheus.Desc
+	constructingConns    *prometheus.Desc
+	totalConns           *prometheus.Desc
+	maxConns             *prometheus.Desc
+	acquireCount         *prometheus.Desc
+	acquireDuration      *prometheus.Desc
+	emptyAcquireCount    *prometheus.Desc
+	emptyAcquireWaitTime *prometheus.Desc
+	canceledAcquireCount *prometheus.Desc
+}
+
+// NewMetrics creates a new Metrics with metric names prefixed by namespace.
+// Query durations are observed in buckets, prometheus.DefBuckets are used if none are given.
+func NewMetrics(namespace string, buckets ...float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+
+	poolDesc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "postgres_pool", name), help, []string{"pool"}, nil)
+	}
+
+	return &Metrics{
+		pools: make(map[string]*pgxpool.Pool),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "postgres",
+			Name:      "query_duration_seconds",
+			Help:      "Duration of postgres queries.",
+			Buckets:   buckets,
+		}, []string{"method", "query"}),
+		queryErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "postgres",
+			Name:      "query_errors_total",
+			Help:      "Number of failed postgres queries.",
+		}, []string{"method", "query"}),
+
+		acquiredConns:     poolDesc("acquired_conns", "Number of currently acquired connections in the pool."),
+		idleConns:         poolDesc("idle_conns", "Number of currently idle connections in the pool."),
+		constructingConns: poolDesc("constructing_conns", "Number of connections with construction in progress."),
+		totalConns:        poolDesc("total_conns", "Total number of connections currently in the pool."),
+		maxConns:          poolDesc("max_conns", "Maximum size of the pool."),
+		acquireCount:      poolDesc("acquire_count_total", "Number of successful acquires from the pool."),
+		acquireDuration: poolDesc(
+			"acquire_duration_seconds_total",
+			"Total duration of all successful acquires from the pool.",
+		),
+		emptyAcquireCount: poolDesc(
+			"empty_acquire_count_total",
+			"Number of successful acquires that waited for a connection to be released or constructed.",
+		),
+		emptyAcquireWaitTime: poolDesc(
+			"empty_acquire_wait_seconds_total",
+			"Total time spent waiting for a connection in acquires from an empty pool.",
+		),
+		canceledAcquireCount: poolDesc(
+			"canceled_acquire_count_total",
+			"Number of acquires from the pool canceled by a context.",
+		),
+	}
+}
+
+// WithQueryName names queries made with ctx for metrics, the query label is empty otherwise.
+// Names should come from a small fixed set to keep the label cardinality low.
+func WithQueryName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, queryNameKey, name)
+}
+
+// QueryName returns the query name set by WithQueryName.
+func QueryName(ctx context.Context) string {
+	name, _ := ctx.Value(queryNameKey).(string)
+	return name
+}
+
+// addPool adds pool stats to metrics with the pool label, labels must be unique.
+func (m *Metrics) addPool(name string, pool *pgxpool.Pool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.pools[name]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicatePoolLabel, name)
+	}
+	m.pools[name] = pool
+	return nil
+}
+
+// removePools removes stats of closed pools.
+func (m *Metrics) removePools(pools ...*pgxpool.Pool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name, pool := range m.pools {
+		for _, closed := range pools {
+			if pool == closed {
+				delete(m.pools, name)
+			}
+		}
+	}
+}
+
+// otherMethod is the method label of queries made outside of the Postgres query methods,
+// e.g. by Queue workers, locks and connection hooks.
+const otherMethod = "other"
+
+// withMethod names the Postgres method making queries with ctx for the method label of metrics.
+func (pg Postgres) withMethod(ctx context.Context, method string) context.Context {
+	if pg.metrics == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, methodKey, method)
+}
+
+// metricsMethod returns the method set by withMethod or otherMethod.
+func metricsMethod(ctx context.Context) string {
+	if method, ok := ctx.Value(methodKey).(string); ok {
+		return method
+	}
+	return otherMethod
+}
+
+// observe records a query made with ctx, labelled by the Postgres method and the name from WithQueryName.
+func (m *Metrics) observe(ctx context.Context, elapsed time.Duration, err error) {
+	method, query := metricsMethod(ctx), QueryName(ctx)
+	m.queryDuration.WithLabelValues(method, query).Observe(elapsed.Seconds())
+	if err != nil {
+		m.queryErrors.WithLabelValues(method, query).Inc()
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	m.queryDuration.Describe(ch)
+	m.queryErrors.Describe(ch)
+
+	ch <- m.acquiredConns
+	ch <- m.idleConns
+	ch <- m.constructingConns
+	ch <- m.totalConns
+	ch <- m.maxConns
+	ch <- m.acquireCount
+	ch <- m.acquireDuration
+	ch <- m.emptyAcquireCount
+	ch <- m.emptyAcquireWaitTime
+	ch <- m.canceledAcquireCount
+}
+
+// Collect implements prometheus.Collector.
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	m.queryDuration.Collect(ch)
+	m.queryErrors.Collect(ch)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for name, pool := range m.pools {
+		stat := pool.Stat()
+
+		gauge := func(desc *prometheus.Desc, v float64) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, v, name)
+		}
+		counter := func(desc *prometheus.Desc, v float64) {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, v, name)
+		}
+
+		gauge(m.acquiredConns, float64(stat.AcquiredConns()))
+		gauge(m.idleConns, float64(stat.IdleConns()))
+		gauge(m.constructingConns, float64(stat.ConstructingConns()))
+		gauge(m.totalConns, float64(stat.TotalConns()))
+		gauge(m.maxConns, float64(stat.MaxConns()))
+		counter(m.acquireCount, float64(stat.AcquireCount()))
+		counter(m.acquireDuration, stat.AcquireDuration().Seconds())
+		counter(m.emptyAcquireCount, float64(stat.EmptyAcquireCount()))
+		counter(m.emptyAcquireWaitTime, stat.EmptyAcquireWaitTime().Seconds())
+		counter(m.canceledAcquireCount, float64(stat.CanceledAcquireCount()))
+	}
+}
@@ -0,0 +1,387 @@
+package postgres
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/yogenyslav/pkg/storage"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const defaultMigrationsTable = "schema_migrations"
+
+var (
+	// ErrDuplicateMigration is an error when two migration files have the same version and direction.
+	ErrDuplicateMigration = errors.New("duplicate migration version")
+	// ErrNoDownMigration is an error when a migration has to be rolled back, but has no down file.
+	ErrNoDownMigration = errors.New("no down migration")
+	// ErrNoUpMigration is an error when a migration has a down file, but no up file.
+	ErrNoUpMigration = errors.New("no up migration")
+	// ErrUnknownMigration is an error when the target version doesn't match any migration.
+	ErrUnknownMigration = errors.New("unknown migration version")
+	// ErrInvalidRollbackSteps is an error when Rollback is called with less than one step.
+	ErrInvalidRollbackSteps = errors.New("rollback steps must be positive")
+)
+
+var migrationFileRe = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`) //nolint:gochecknoglobals // compiled once
+
+// MigrationDirection is a direction in which a migration is applied.
+type MigrationDirection string
+
+const (
+	// MigrationUp applies a migration.
+	MigrationUp MigrationDirection = "up"
+	// MigrationDown rolls back a migration.
+	MigrationDown MigrationDirection = "down"
+)
+
+// Migration is a versioned schema change read from a pair of up/down sql files.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus describes whether a migration was applied.
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// MigrationStep is a migration planned to be applied in the given direction.
+type MigrationStep struct {
+	Migration
+	Direction MigrationDirection
+}
+
+// MigratorOpt is an alias for migrator options.
+type MigratorOpt func(*Migrator)
+
+// WithMigrationsTable sets the table where applied versions are recorded, schema_migrations by default.
+func WithMigrationsTable(table string) MigratorOpt {
+	return func(m *Migrator) {
+		m.table = table
+	}
+}
+
+// Migrator applies versioned sql migrations, recording applied versions in a tracking table.
+// Concurrent migrators using the same tracking table are serialized with an advisory lock.
+type Migrator struct {
+	pg         Postgres
+	migrations []Migration
+	table      string
+}
+
+// NewMigrator reads migrations from the root of fsys.
+// Files must be named as <version>_<name>.up.sql and <version>_<name>.down.sql, other files are ignored.
+func NewMigrator(pg Postgres, fsys fs.FS, opts ...MigratorOpt) (*Migrator, error) {
+	migrations, err := readMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Migrator{
+		pg:         pg,
+		migrations: migrations,
+		table:      defaultMigrationsTable,
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m, nil
+}
+
+// Migrations returns all known migrations ordered by version.
+func (m *Migrator) Migrations() []Migration {
+	return slices.Clone(m.migrations)
+}
+
+// Up applies all pending migrations.
+func (m *Migrator) Up(ctx context.Context) error {
+	if len(m.migrations) == 0 {
+		return nil
+	}
+	return m.MigrateTo(ctx, m.migrations[len(m.migrations)-1].Version)
+}
+
+// MigrateTo applies or rolls back migrations so that version is the latest applied one.
+// Version 0 rolls back all migrations.
+func (m *Migrator) MigrateTo(ctx context.Context, version int64) error {
+	ctx, span := m.pg.trace(ctx, "Migrator.MigrateTo", attribute.Int64("version", version))
+	defer span.End()
+
+	return m.withLock(ctx, func(ctx context.Context) error {
+		steps, err := m.plan(ctx, version)
+		if err != nil {
+			return err
+		}
+		return m.run(ctx, steps)
+	})
+}
+
+// Rollback rolls back the given number of latest applied migrations, steps must be positive.
+func (m *Migrator) Rollback(ctx context.Context, steps int) error {
+	if steps < 1 {
+		return fmt.Errorf("%w: %d", ErrInvalidRollbackSteps, steps)
+	}
+
+	ctx, span := m.pg.trace(ctx, "Migrator.Rollback", attribute.Int("steps", steps))
+	defer span.End()
+
+	return m.withLock(ctx, func(ctx context.Context) error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+
+		var plan []MigrationStep
+		for _, migration := range slices.Backward(m.migrations) {
+			if len(plan) == steps {
+				break
+			}
+			if _, ok := applied[migration.Version]; ok {
+				plan = append(plan, MigrationStep{Migration: migration, Direction: MigrationDown})
+			}
+		}
+		return m.run(ctx, plan)
+	})
+}
+
+// Status returns all known migrations with their applied state without changing anything.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	ctx, span := m.pg.trace(ctx, "Migrator.Status")
+	defer span.End()
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, len(m.migrations))
+	for i, migration := range m.migrations {
+		appliedAt, ok := applied[migration.Version]
+		status[i] = MigrationStatus{
+			Migration: migration,
+			Applied:   ok,
+			AppliedAt: appliedAt,
+		}
+	}
+	return status, nil
+}
+
+// Plan returns migrations that MigrateTo would run for version without changing anything.
+func (m *Migrator) Plan(ctx context.Context, version int64) ([]MigrationStep, error) {
+	ctx, span := m.pg.trace(ctx, "Migrator.Plan", attribute.Int64("version", version))
+	defer span.End()
+
+	return m.plan(ctx, version)
+}
+
+func (m *Migrator) plan(ctx context.Context, version int64) ([]MigrationStep, error) {
+	known := version == 0 || slices.ContainsFunc(m.migrations, func(migration Migration) bool {
+		return migration.Version == version
+	})
+	if !known {
+		return nil, fmt.Errorf("migrate to %d: %w", version, ErrUnknownMigration)
+	}
+
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var steps []MigrationStep
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; !ok && migration.Version <= version {
+			steps = append(steps, MigrationStep{Migration: migration, Direction: MigrationUp})
+		}
+	}
+	for _, migration := range slices.Backward(m.migrations) {
+		if _, ok := applied[migration.Version]; ok && migration.Version > version {
+			steps = append(steps, MigrationStep{Migration: migration, Direction: MigrationDown})
+		}
+	}
+	return steps, nil
+}
+
+// run applies every step in its own transaction.
+func (m *Migrator) run(ctx context.Context, steps []MigrationStep) error {
+	for _, step := range steps {
+		if step.Direction == MigrationDown && step.Down == "" {
+			return fmt.Errorf("roll back %d_%s: %w", step.Version, step.Name, ErrNoDownMigration)
+		}
+	}
+
+	table := m.tableIdent()
+	for _, step := range steps {
+		query := step.Up
+		record := "insert into " + table + " (version, name) values ($1, $2)"
+		args := []any{step.Version, step.Name}
+		if step.Direction == MigrationDown {
+			query = step.Down
+			record = "delete from " + table + " where version = $1"
+			args = args[:1]
+		}
+
+		err := m.pg.WithTx(ctx, storage.TxOptions{}, func(ctx context.Context) error {
+			ctx, span := m.pg.trace(
+				ctx,
+				"Migrator.Migrate",
+				attribute.Int64("version", step.Version),
+				attribute.String("name", step.Name),
+				attribute.String("direction", string(step.Direction)),
+			)
+			defer span.End()
+
+			if _, err := m.pg.ExecTx(ctx, query); err != nil {
+				return err
+			}
+			_, err := m.pg.ExecTx(ctx, record, args...)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("migrate %s %d_%s: %w", step.Direction, step.Version, step.Name, err)
+		}
+	}
+	return nil
+}
+
+// applied returns applied versions with the time they were applied at.
+// The tracking table is read on the primary, a lagging replica could report applied migrations as pending.
+func (m *Migrator) applied(ctx context.Context) (map[int64]time.Time, error) {
+	ctx = WithPrimary(ctx)
+
+	var exists bool
+	if err := m.pg.Query(ctx, &exists, "select to_regclass($1) is not null", m.tableIdent()); err != nil {
+		return nil, fmt.Errorf("check migrations table: %w", err)
+	}
+	if !exists {
+		return map[int64]time.Time{}, nil
+	}
+
+	var rows []struct {
+		Version   int64     `db:"version"`
+		AppliedAt time.Time `db:"applied_at"`
+	}
+	if err := m.pg.QuerySlice(ctx, &rows, "select version, applied_at from "+m.tableIdent()); err != nil {
+		return nil, fmt.Errorf("get applied migrations: %w", err)
+	}
+
+	applied := make(map[int64]time.Time, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row.AppliedAt
+	}
+	return applied, nil
+}
+
+// withLock creates the tracking table and runs fn holding an advisory lock for it.
+// Tenants from ctx are locked separately, so their schemas can be migrated in parallel.
+func (m *Migrator) withLock(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	key := m.table
+	if tenant, ok := Tenant(ctx); ok {
+		key = m.pg.TenantSchema(tenant) + "." + key
+	}
+
+	lock, err := m.pg.Lock(ctx, key)
+	if err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer func() {
+		if unlockErr := lock.Unlock(context.WithoutCancel(ctx)); unlockErr != nil {
+			err = errors.Join(err, fmt.Errorf("release migration lock: %w", unlockErr))
+		}
+	}()
+
+	_, err = m.pg.Exec(ctx, `create table if not exists `+m.tableIdent()+` (
+		version bigint primary key,
+		name text not null,
+		applied_at timestamptz not null default now()
+	)`)
+	if err != nil {
+		return fmt.Errorf("create migrations table: %w", err)
+	}
+
+	return fn(ctx)
+}
+
+func (m *Migrator) tableIdent() string {
+	return pgx.Identifier(strings.Split(m.table, ".")).Sanitize()
+}
+
+// readMigrations reads up/down migration files from the root of fsys ordered by version.
+func readMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations dir: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	type versionDirection struct {
+		version   int64
+		direction string
+	}
+	seen := make(map[versionDirection]struct{})
+	for _, entry := range entries {
+		match := migrationFileRe.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse migration version %s: %w", entry.Name(), err)
+		}
+
+		data, err := fs.ReadFile(fsys, entry.Name())
+		if err != nil {
+			return nil, fmt.Errorf("read migration %s: %w", entry.Name(), err)
+		}
+
+		key := versionDirection{version: version, direction: match[3]}
+		if _, ok := seen[key]; ok {
+			return nil, fmt.Errorf("%s: %w", entry.Name(), ErrDuplicateMigration)
+		}
+		seen[key] = struct{}{}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("%s: %w", entry.Name(), ErrDuplicateMigration)
+		}
+
+		if MigrationDirection(match[3]) == MigrationDown {
+			migration.Down = string(data)
+		} else {
+			migration.Up = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for version, migration := range byVersion {
+		if _, ok := seen[versionDirection{version: version, direction: string(MigrationUp)}]; !ok {
+			return nil, fmt.Errorf("%d_%s: %w", version, migration.Name, ErrNoUpMigration)
+		}
+		migrations = append(migrations, *migration)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+	return migrations, nil
+}
@@ -0,0 +1,50 @@
+package postgres_test
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/yogenyslav/pkg/storage/postgres"
+)
+
+func TestNewMigratorValidatesFiles(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		wantErr error
+	}{
+		{
+			name: "up and down",
+			files: fstest.MapFS{
+				"1_users.up.sql":   {Data: []byte("create table users ()")},
+				"1_users.down.sql": {Data: []byte("drop table users")},
+				"2_empty.up.sql":   {Data: []byte("")},
+			},
+		},
+		{
+			name: "down without up",
+			files: fstest.MapFS{
+				"1_users.up.sql":    {Data: []byte("create table users ()")},
+				"2_orders.down.sql": {Data: []byte("drop table orders")},
+			},
+			wantErr: postgres.ErrNoUpMigration,
+		},
+		{
+			name: "same version with leading zeros",
+			files: fstest.MapFS{
+				"1_users.up.sql":   {Data: []byte("create table users ()")},
+				"001_users.up.sql": {Data: []byte("create table users ()")},
+			},
+			wantErr: postgres.ErrDuplicateMigration,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := postgres.NewMigrator(postgres.Postgres{}, tt.files)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("NewMigrator() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package postgres
+
+// PostgresOpt is an alias for postgres options.
+type PostgresOpt func(*Postgres)
+
+// WithAmbientTx makes Query, QuerySlice and Exec run in the transaction from ctx when there is one
+// and fall back to the pool otherwise, so the same repository code works inside and outside transactions.
+func WithAmbientTx() PostgresOpt {
+	return func(pg *Postgres) {
+		pg.ambientTx = true
+	}
+}
+
+// WithMetrics makes Postgres report pool stats and query metrics to m.
+// Query duration and errors are labelled by operation and by the name set with WithQueryName.
+func WithMetrics(m *Metrics) PostgresOpt {
+	return func(pg *Postgres) {
+		pg.metrics = m
+	}
+}
+
+// WithAudit makes transactions record the actor set by WithActor, so audit triggers installed by Auditor.Track
+// know who made a change. The actor is set once when a transaction is started, writes outside of a transaction
+// are recorded without an actor.
+func WithAudit() PostgresOpt {
+	return func(pg *Postgres) {
+		pg.audit = true
+	}
+}
@@ -0,0 +1,287 @@
+// Package outbox provides a transactional outbox on top of postgres with a relay to NATS JetStream or Kafka.
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/yogenyslav/pkg/storage"
+	"github.com/yogenyslav/pkg/storage/postgres"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultTable        = "outbox"
+	defaultBatchSize    = 100
+	defaultPollInterval = time.Second
+)
+
+// ErrNoEvents is an error when Add is called without events.
+var ErrNoEvents = errors.New("no events to add")
+
+// Event is a message stored in the outbox until it's published.
+type Event struct {
+	// ID is a unique id used as a deduplication key by brokers, generated if empty.
+	ID string `db:"event_id"`
+	// Topic is a NATS subject or a Kafka topic.
+	Topic string `db:"topic"`
+	// Key is a Kafka partition key, ID is used if empty.
+	Key     string            `db:"key"`
+	Payload []byte            `db:"payload"`
+	Headers map[string]string `db:"headers"`
+}
+
+// Publisher publishes outbox events to a broker.
+type Publisher interface {
+	// Publish publishes the event and waits for the broker to acknowledge it.
+	Publish(ctx context.Context, e Event) error
+}
+
+// Config is the configuration for the outbox, defaults are used for zero values.
+type Config struct {
+	// Table is a table for events, "outbox" by default.
+	Table string `yaml:"table"`
+	// Channel is a notification channel used to wake the relay up after commit, the relay only polls if empty.
+	Channel string `yaml:"channel"`
+	// BatchSize is a max number of events published in one relay transaction, 100 by default.
+	BatchSize int `yaml:"batch_size"`
+	// PollIntervalMs is how often the relay looks for unsent events, 1 second by default.
+	PollIntervalMs int `yaml:"poll_interval_ms"`
+}
+
+// Outbox stores events in the same transaction as the business data and relays them to a broker.
+type Outbox struct {
+	pg     postgres.Postgres
+	cfg    Config
+	table  string
+	tracer trace.Tracer
+}
+
+// New creates a new Outbox.
+func New(pg postgres.Postgres, cfg Config, tracer trace.Tracer) *Outbox {
+	if cfg.Table == "" {
+		cfg.Table = defaultTable
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+
+	return &Outbox{
+		pg:     pg,
+		cfg:    cfg,
+		table:  pgx.Identifier(strings.Split(cfg.Table, ".")).Sanitize(),
+		tracer: tracer,
+	}
+}
+
+func (o *Outbox) trace(
+	ctx context.Context,
+	spanName string,
+	attrs ...attribute.KeyValue,
+) (context.Context, trace.Span) {
+	if o.tracer == nil {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+
+	ctx, span := o.tracer.Start(ctx, spanName, trace.WithAttributes(attrs...))
+	return ctx, span
+}
+
+// CreateTable creates the outbox table if it doesn't exist.
+func (o *Outbox) CreateTable(ctx context.Context) error {
+	_, err := o.pg.Exec(ctx, `
+		create table if not exists `+o.table+` (
+			id bigserial primary key,
+			event_id text not null unique,
+			topic text not null,
+			key text not null default '',
+			payload bytea not null,
+			headers jsonb not null default '{}',
+			created_at timestamptz not null default now(),
+			sent_at timestamptz,
+			attempts int not null default 0,
+			last_error text
+		);
+		create index if not exists `+pgx.Identifier{strings.ReplaceAll(o.cfg.Table, ".", "_") + "_unsent"}.Sanitize()+`
+			on `+o.table+` (id) where sent_at is null;
+	`)
+	if err != nil {
+		return fmt.Errorf("create outbox table: %w", err)
+	}
+	return nil
+}
+
+// Add stores events in the transaction from ctx, so they are published only if it commits.
+// The current trace context is stored in event headers and propagated to the broker.
+func (o *Outbox) Add(ctx context.Context, events ...Event) error {
+	ctx, span := o.trace(ctx, "Outbox.Add", attribute.Int("events", len(events)))
+	defer span.End()
+
+	if len(events) == 0 {
+		return ErrNoEvents
+	}
+
+	if _, err := o.pg.GetTx(ctx); err != nil {
+		return fmt.Errorf("add events to outbox: %w", err)
+	}
+
+	var batch postgres.Batch
+	for _, e := range events {
+		if e.ID == "" {
+			e.ID = uuid.NewString()
+		}
+
+		headers := make(map[string]string, len(e.Headers))
+		for k, v := range e.Headers {
+			headers[k] = v
+		}
+		propagation.TraceContext{}.Inject(ctx, propagation.MapCarrier(headers))
+
+		batch.Exec(
+			"insert into "+o.table+" (event_id, topic, key, payload, headers) values ($1, $2, $3, $4, $5)",
+			e.ID, e.Topic, e.Key, e.Payload, headers,
+		)
+	}
+
+	if _, err := o.pg.SendBatch(ctx, &batch); err != nil {
+		desc := "failed to add events to outbox"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, desc)
+		return fmt.Errorf("%s: %w", desc, err)
+	}
+
+	if o.cfg.Channel != "" {
+		if err := o.pg.Notify(ctx, o.cfg.Channel, ""); err != nil {
+			return fmt.Errorf("notify outbox relay: %w", err)
+		}
+	}
+	return nil
+}
+
+// Relay publishes unsent events with pub in order of insertion until ctx is canceled.
+// Several relays may run concurrently, each event is locked by one of them while it's published.
+//
+// Events are delivered at least once: if the relay dies after publishing, the event is published again,
+// so consumers should deduplicate by event id.
+func (o *Outbox) Relay(ctx context.Context, pub Publisher) {
+	wakeup := make(<-chan postgres.Notification)
+	if o.cfg.Channel != "" {
+		if notifications, err := o.pg.Listen(ctx, o.cfg.Channel); err == nil {
+			wakeup = notifications
+		}
+	}
+
+	pollInterval := defaultPollInterval
+	if o.cfg.PollIntervalMs > 0 {
+		pollInterval = time.Millisecond * time.Duration(o.cfg.PollIntervalMs)
+	}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		// publish while there are full batches
+		for {
+			n, err := o.relayBatch(ctx, pub)
+			if err != nil || n < o.cfg.BatchSize {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-wakeup:
+		}
+	}
+}
+
+// relayBatch publishes one batch of unsent events in a transaction and marks published ones as sent.
+// Publishing stops at the first failed event, its attempt is recorded and the publish error is returned.
+// Returns number of published events.
+func (o *Outbox) relayBatch(ctx context.Context, pub Publisher) (int, error) {
+	var (
+		sent       int
+		publishErr error
+	)
+	err := o.pg.WithTx(ctx, storage.TxOptions{}, func(ctx context.Context) error {
+		publishErr = nil
+
+		var rows []struct {
+			Event
+			ID int64 `db:"id"`
+		}
+		err := o.pg.QuerySliceTx(ctx, &rows, `
+			select id, event_id, topic, key, payload, headers from `+o.table+`
+			where sent_at is null
+			order by id
+			limit $1
+			for update skip locked`,
+			o.cfg.BatchSize,
+		)
+		if err != nil {
+			return err
+		}
+
+		ids := make([]int64, 0, len(rows))
+		for _, row := range rows {
+			if publishErr = o.publish(ctx, pub, row.Event); publishErr != nil {
+				_, err = o.pg.ExecTx(
+					ctx,
+					"update "+o.table+" set attempts = attempts + 1, last_error = $2 where id = $1",
+					row.ID, publishErr.Error(),
+				)
+				if err != nil {
+					return err
+				}
+				break
+			}
+			ids = append(ids, row.ID)
+		}
+
+		if len(ids) > 0 {
+			if _, err = o.pg.ExecTx(ctx, "update "+o.table+" set sent_at = now() where id = any($1)", ids); err != nil {
+				return err
+			}
+		}
+
+		sent = len(ids)
+		// commit sent events and the failed attempt, the publish error is returned after the commit
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("relay outbox events: %w", err)
+	}
+	if publishErr != nil {
+		return sent, fmt.Errorf("relay outbox events: %w", publishErr)
+	}
+	return sent, nil
+}
+
+// publish publishes e within the trace it was added in.
+func (o *Outbox) publish(ctx context.Context, pub Publisher, e Event) error {
+	ctx = propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier(e.Headers))
+	ctx, span := o.trace(
+		ctx,
+		"Outbox.Publish",
+		attribute.String("event_id", e.ID),
+		attribute.String("topic", e.Topic),
+	)
+	defer span.End()
+
+	if err := pub.Publish(ctx, e); err != nil {
+		desc := "failed to publish event"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, desc)
+		return fmt.Errorf("%s %s: %w", desc, e.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/yogenyslav/pkg/storage"
+	"github.com/yogenyslav/pkg/storage/storagetest"
+)
+
+// failingPublisher fails to publish the event with the given id.
+type failingPublisher struct {
+	failID    string
+	published []string
+}
+
+func (p *failingPublisher) Publish(_ context.Context, e Event) error {
+	if e.ID == p.failID {
+		return errors.New("broker unavailable")
+	}
+	p.published = append(p.published, e.ID)
+	return nil
+}
+
+func TestRelayBatchRecordsPartialFailure(t *testing.T) {
+	pg := storagetest.NewPostgres(t)
+	ctx := t.Context()
+
+	const table = "outbox_relay_test"
+	dropTable := func() {
+		if _, err := pg.Exec(context.WithoutCancel(ctx), "drop table if exists "+table); err != nil {
+			t.Errorf("drop table: %v", err)
+		}
+	}
+	dropTable()
+	t.Cleanup(dropTable)
+
+	o := New(pg, Config{Table: table}, nil)
+	if err := o.CreateTable(ctx); err != nil {
+		t.Fatalf("CreateTable: %v", err)
+	}
+
+	events := []Event{
+		{ID: "e1", Topic: "t", Payload: []byte("1")},
+		{ID: "e2", Topic: "t", Payload: []byte("2")},
+		{ID: "e3", Topic: "t", Payload: []byte("3")},
+		{ID: "e4", Topic: "t", Payload: []byte("4")},
+	}
+	err := pg.WithTx(ctx, storage.TxOptions{}, func(ctx context.Context) error {
+		return o.Add(ctx, events...)
+	})
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+
+	pub := &failingPublisher{failID: "e3"}
+	for attempt := 1; attempt <= 2; attempt++ {
+		sent, err := o.relayBatch(ctx, pub)
+		if err == nil {
+			t.Fatalf("relay attempt %d: expected the publish error", attempt)
+		}
+		wantSent := 2
+		if attempt > 1 {
+			// e1 and e2 were sent by the first attempt
+			wantSent = 0
+		}
+		if sent != wantSent {
+			t.Errorf("relay attempt %d: sent %d events, want %d", attempt, sent, wantSent)
+		}
+
+		var rows []struct {
+			EventID  string `db:"event_id"`
+			Sent     bool   `db:"sent"`
+			Attempts int    `db:"attempts"`
+		}
+		err = pg.QuerySlice(ctx, &rows,
+			"select event_id, sent_at is not null as sent, attempts from "+table+" order by id")
+		if err != nil {
+			t.Fatalf("get events: %v", err)
+		}
+		if len(rows) != len(events) {
+			t.Fatalf("got %d events, want %d", len(rows), len(events))
+		}
+
+		for i, wantSent := range []bool{true, true, false, false} {
+			if rows[i].Sent != wantSent {
+				t.Errorf("relay attempt %d: event %s sent = %t, want %t",
+					attempt, rows[i].EventID, rows[i].Sent, wantSent)
+			}
+		}
+		if rows[2].Attempts != attempt {
+			t.Errorf("relay attempt %d: failed event attempts = %d, want %d", attempt, rows[2].Attempts, attempt)
+		}
+		if rows[3].Attempts != 0 {
+			t.Errorf("relay attempt %d: event after the failed one attempts = %d, want 0", attempt, rows[3].Attempts)
+		}
+	}
+
+	if len(pub.published) != 2 {
+		t.Errorf("published %v, want each of e1 and e2 once", pub.published)
+	}
+}
@@ -0,0 +1,78 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/IBM/sarama"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/yogenyslav/pkg/infrastructure/kafka"
+	"github.com/yogenyslav/pkg/infrastructure/nats"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// NatsPublisher publishes events to NATS JetStream, using the event id as the message deduplication id.
+type NatsPublisher struct {
+	n *nats.Nats
+}
+
+// NewNatsPublisher creates a new NatsPublisher, jetstream must be enabled for n.
+func NewNatsPublisher(n *nats.Nats) NatsPublisher {
+	return NatsPublisher{n: n}
+}
+
+// Publish implements Publisher.
+func (p NatsPublisher) Publish(ctx context.Context, e Event) error {
+	headers := make(map[string]string, len(e.Headers)+2)
+	for k, v := range e.Headers {
+		headers[k] = v
+	}
+	headers["messageID"] = e.ID
+	headers[jetstream.MsgIDHeader] = e.ID
+
+	if err := p.n.PublishSync(ctx, e.Topic, "", e.Payload, headers); err != nil {
+		return fmt.Errorf("publish to jetstream: %w", err)
+	}
+	return nil
+}
+
+// KafkaPublisher publishes events to Kafka, using the event id as a message header for consumer deduplication.
+type KafkaPublisher struct {
+	producer *kafka.SyncProducer
+}
+
+// NewKafkaPublisher creates a new KafkaPublisher.
+func NewKafkaPublisher(producer *kafka.SyncProducer) KafkaPublisher {
+	return KafkaPublisher{producer: producer}
+}
+
+// Publish implements Publisher.
+func (p KafkaPublisher) Publish(ctx context.Context, e Event) error {
+	key := e.Key
+	if key == "" {
+		key = e.ID
+	}
+
+	headers := make(map[string]string, len(e.Headers)+1)
+	for k, v := range e.Headers {
+		headers[k] = v
+	}
+	headers["messageID"] = e.ID
+	propagation.TraceContext{}.Inject(ctx, propagation.MapCarrier(headers))
+
+	recordHeaders := make([]sarama.RecordHeader, 0, len(headers))
+	for k, v := range headers {
+		recordHeaders = append(recordHeaders, sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+	}
+
+	err := p.producer.SendMessage(&sarama.ProducerMessage{
+		Topic:   e.Topic,
+		Key:     sarama.StringEncoder(key),
+		Value:   sarama.ByteEncoder(e.Payload),
+		Headers: recordHeaders,
+	})
+	if err != nil {
+		return fmt.Errorf("publish to kafka: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,359 @@
+package postgres
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/yogenyslav/pkg/storage"
+)
+
+const defaultPageLimit = 20
+
+var (
+	// ErrInvalidCursor is an error when a cursor token is malformed, was tampered with
+	// or belongs to another query or ordering.
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrEmptySecret is an error when a Paginator is created without a key to sign cursors.
+	ErrEmptySecret = errors.New("empty cursor secret")
+	// ErrUnknownSortColumn is an error when a sort column doesn't match any field of the page item type.
+	ErrUnknownSortColumn = errors.New("sort column doesn't match any field")
+	// ErrNoSortColumns is an error when keyset pagination is requested without sort columns.
+	ErrNoSortColumns = errors.New("no sort columns")
+)
+
+// Page is a page of query results, ready to be serialized as a JSON response.
+type Page[T any] struct {
+	Items []T `json:"items"`
+	// NextCursor is a token to request the next page with, empty for the last page and for offset pagination.
+	NextCursor string `json:"next_cursor,omitempty"`
+	HasMore    bool   `json:"has_more"`
+	// Total is the number of rows in the whole result set, nil unless requested.
+	Total *int64 `json:"total,omitempty"`
+}
+
+// SortColumn is a column to order a page by.
+type SortColumn struct {
+	Column string
+	Desc   bool
+}
+
+// KeysetQuery is a request for a page using keyset pagination.
+type KeysetQuery struct {
+	// Query is the base query without ORDER BY and LIMIT clauses.
+	Query string
+	Args  []any
+	// OrderBy are non-null columns of the base query, together they must uniquely identify a row.
+	OrderBy []SortColumn
+	// Limit is a page size, 20 if zero.
+	Limit int
+	// Cursor is a NextCursor of the previous page of the same query with the same args, empty for the first page.
+	Cursor string
+	// WithTotal requests the total number of rows.
+	WithTotal bool
+}
+
+// OffsetQuery is a request for a page using limit and offset.
+type OffsetQuery struct {
+	// Query is the base query without ORDER BY, LIMIT and OFFSET clauses.
+	Query string
+	Args  []any
+	// OrderBy are columns of the base query, together they must uniquely identify a row for pages to be stable.
+	OrderBy []SortColumn
+	// Limit is a page size, 20 if zero.
+	Limit     int
+	Offset    int
+	WithTotal bool
+}
+
+// Paginator signs cursor tokens so that clients can't forge them.
+type Paginator struct {
+	secret []byte
+}
+
+// NewPaginator creates a new Paginator with the key used to sign cursors, the key must not be empty.
+func NewPaginator(secret []byte) (Paginator, error) {
+	if len(secret) == 0 {
+		return Paginator{}, ErrEmptySecret
+	}
+	return Paginator{secret: slices.Clone(secret)}, nil
+}
+
+// cursor is a signed payload of a cursor token.
+type cursor struct {
+	Order string `json:"o"`
+	// Query is a hash of the base query and its args, so a cursor can't be replayed against another query.
+	Query  string            `json:"q"`
+	Values []json.RawMessage `json:"v"`
+}
+
+// Paginate returns a page of the keyset query, in the transaction from ctx if there is one.
+// T must be a struct with fields for every sort column, mapped the same way scany maps them.
+func Paginate[T any](ctx context.Context, db storage.SQLDatabase, p Paginator, q KeysetQuery) (Page[T], error) {
+	if len(q.OrderBy) == 0 {
+		return Page[T]{}, ErrNoSortColumns
+	}
+	if len(p.secret) == 0 {
+		return Page[T]{}, ErrEmptySecret
+	}
+
+	columns, err := sortFields[T](q.OrderBy)
+	if err != nil {
+		return Page[T]{}, err
+	}
+
+	hash, err := queryHash(q.Query, q.Args)
+	if err != nil {
+		return Page[T]{}, err
+	}
+
+	limit := pageLimit(q.Limit)
+	args := append([]any{}, q.Args...)
+
+	var sb strings.Builder
+	sb.WriteString("select * from (" + q.Query + ") as page")
+	if q.Cursor != "" {
+		values, err := p.decode(q.Cursor, hash, q.OrderBy, columns)
+		if err != nil {
+			return Page[T]{}, err
+		}
+		sb.WriteString(" where " + keysetCondition(q.OrderBy, len(args)))
+		args = append(args, values...)
+	}
+	sb.WriteString(orderByClause(q.OrderBy))
+	sb.WriteString(" limit " + strconv.Itoa(limit+1))
+
+	items, err := Select[T](ctx, db, sb.String(), args...)
+	if err != nil {
+		return Page[T]{}, fmt.Errorf("get page: %w", err)
+	}
+
+	page := Page[T]{Items: items}
+	if len(items) > limit {
+		page.Items = items[:limit]
+		page.HasMore = true
+
+		page.NextCursor, err = p.encode(page.Items[limit-1], hash, q.OrderBy, columns)
+		if err != nil {
+			return Page[T]{}, err
+		}
+	}
+
+	if q.WithTotal {
+		if page.Total, err = countTotal(ctx, db, q.Query, q.Args); err != nil {
+			return Page[T]{}, err
+		}
+	}
+	return page, nil
+}
+
+// PaginateOffset returns a page of the query using limit and offset, in the transaction from ctx if there is one.
+func PaginateOffset[T any](ctx context.Context, db storage.SQLDatabase, q OffsetQuery) (Page[T], error) {
+	if len(q.OrderBy) == 0 {
+		return Page[T]{}, ErrNoSortColumns
+	}
+
+	limit := pageLimit(q.Limit)
+	args := append([]any{}, q.Args...)
+
+	query := "select * from (" + q.Query + ") as page" + orderByClause(q.OrderBy) +
+		" limit $" + strconv.Itoa(len(args)+1) + " offset $" + strconv.Itoa(len(args)+2)
+	args = append(args, limit+1, q.Offset)
+
+	items, err := Select[T](ctx, db, query, args...)
+	if err != nil {
+		return Page[T]{}, fmt.Errorf("get page: %w", err)
+	}
+
+	page := Page[T]{Items: items}
+	if len(items) > limit {
+		page.Items = items[:limit]
+		page.HasMore = true
+	}
+
+	if q.WithTotal {
+		if page.Total, err = countTotal(ctx, db, q.Query, q.Args); err != nil {
+			return Page[T]{}, err
+		}
+	}
+	return page, nil
+}
+
+func pageLimit(limit int) int {
+	if limit <= 0 {
+		return defaultPageLimit
+	}
+	return limit
+}
+
+func countTotal(ctx context.Context, db storage.SQLDatabase, query string, args []any) (*int64, error) {
+	total, err := Get[int64](ctx, db, "select count(*) from ("+query+") as page", args...)
+	if err != nil {
+		return nil, fmt.Errorf("count total: %w", err)
+	}
+	return &total, nil
+}
+
+func orderByClause(orderBy []SortColumn) string {
+	if len(orderBy) == 0 {
+		return ""
+	}
+
+	parts := make([]string, len(orderBy))
+	for i, sc := range orderBy {
+		parts[i] = pgx.Identifier{sc.Column}.Sanitize()
+		if sc.Desc {
+			parts[i] += " desc"
+		}
+	}
+	return " order by " + strings.Join(parts, ", ")
+}
+
+// keysetCondition builds a condition selecting rows after the cursor,
+// e.g. (a > $1) or (a = $1 and b < $2) for "a asc, b desc".
+func keysetCondition(orderBy []SortColumn, argOffset int) string {
+	disjuncts := make([]string, len(orderBy))
+	for i := range orderBy {
+		conjuncts := make([]string, 0, i+1)
+		for j := range i {
+			column := pgx.Identifier{orderBy[j].Column}.Sanitize()
+			conjuncts = append(conjuncts, fmt.Sprintf("%s = $%d", column, argOffset+j+1))
+		}
+
+		op := ">"
+		if orderBy[i].Desc {
+			op = "<"
+		}
+		column := pgx.Identifier{orderBy[i].Column}.Sanitize()
+		conjuncts = append(conjuncts, fmt.Sprintf("%s %s $%d", column, op, argOffset+i+1))
+
+		disjuncts[i] = "(" + strings.Join(conjuncts, " and ") + ")"
+	}
+	return "(" + strings.Join(disjuncts, " or ") + ")"
+}
+
+// sortFields returns fields of T matching sort columns.
+func sortFields[T any](orderBy []SortColumn) ([]structColumn, error) {
+	t, ok := structType(reflect.TypeFor[T]())
+	if !ok {
+		return nil, fmt.Errorf("page item must be a struct: %w", ErrUnknownSortColumn)
+	}
+
+	byName := make(map[string]structColumn)
+	for _, column := range structColumns(t) {
+		byName[column.name] = column
+	}
+
+	columns := make([]structColumn, len(orderBy))
+	for i, sc := range orderBy {
+		column, ok := byName[sc.Column]
+		if !ok {
+			return nil, fmt.Errorf("%s: %w", sc.Column, ErrUnknownSortColumn)
+		}
+		columns[i] = column
+	}
+	return columns, nil
+}
+
+// orderSignature identifies an ordering, so that a cursor can't be used with another one.
+func orderSignature(orderBy []SortColumn) string {
+	var sb strings.Builder
+	for _, sc := range orderBy {
+		sb.WriteString(sc.Column)
+		if sc.Desc {
+			sb.WriteString(" desc")
+		}
+		sb.WriteString(",")
+	}
+	return sb.String()
+}
+
+// queryHash identifies the base query with its args, so that a cursor can't be used with another one.
+func queryHash(query string, args []any) (string, error) {
+	encodedArgs, err := json.Marshal(args)
+	if err != nil {
+		return "", fmt.Errorf("marshal query args for cursor: %w", err)
+	}
+
+	h := sha256.New()
+	h.Write([]byte(query))
+	h.Write([]byte{0})
+	h.Write(encodedArgs)
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)[:16]), nil
+}
+
+// encode creates a signed cursor token from sort column values of item.
+func (p Paginator) encode(item any, hash string, orderBy []SortColumn, columns []structColumn) (string, error) {
+	v := reflect.Indirect(reflect.ValueOf(item))
+
+	c := cursor{
+		Order:  orderSignature(orderBy),
+		Query:  hash,
+		Values: make([]json.RawMessage, len(columns)),
+	}
+	for i, column := range columns {
+		value, err := json.Marshal(column.value(v))
+		if err != nil {
+			return "", fmt.Errorf("marshal cursor value %s: %w", column.name, err)
+		}
+		c.Values[i] = value
+	}
+
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("marshal cursor: %w", err)
+	}
+
+	mac := p.sign(payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac), nil
+}
+
+// decode verifies a cursor token and decodes its values into types of the sort fields.
+func (p Paginator) decode(token, hash string, orderBy []SortColumn, columns []structColumn) ([]any, error) {
+	encodedPayload, encodedMAC, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil || !hmac.Equal(mac, p.sign(payload)) {
+		return nil, ErrInvalidCursor
+	}
+
+	var c cursor
+	if err = json.Unmarshal(payload, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if c.Order != orderSignature(orderBy) || c.Query != hash || len(c.Values) != len(columns) {
+		return nil, ErrInvalidCursor
+	}
+
+	values := make([]any, len(columns))
+	for i, column := range columns {
+		value := reflect.New(column.typ)
+		if err = json.Unmarshal(c.Values[i], value.Interface()); err != nil {
+			return nil, ErrInvalidCursor
+		}
+		values[i] = value.Elem().Interface()
+	}
+	return values, nil
+}
+
+func (p Paginator) sign(payload []byte) []byte {
+	h := hmac.New(sha256.New, p.secret)
+	h.Write(payload)
+	return h.Sum(nil)
+}
@@ -0,0 +1,239 @@
+package postgres
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type pageItem struct {
+	ID        int64     `db:"id"`
+	CreatedAt time.Time `db:"created_at"`
+	Name      string
+}
+
+func newTestPaginator(t *testing.T, secret string) Paginator {
+	t.Helper()
+	p, err := NewPaginator([]byte(secret))
+	if err != nil {
+		t.Fatalf("NewPaginator: %v", err)
+	}
+	return p
+}
+
+// tamper flips a bit in the first byte of the decoded part of the token.
+func tamper(t *testing.T, token string, part int) string {
+	t.Helper()
+	parts := strings.Split(token, ".")
+	data, err := base64.RawURLEncoding.DecodeString(parts[part])
+	if err != nil {
+		t.Fatalf("decode token: %v", err)
+	}
+	data[0] ^= 1
+	parts[part] = base64.RawURLEncoding.EncodeToString(data)
+	return strings.Join(parts, ".")
+}
+
+func TestNewPaginatorRejectsEmptySecret(t *testing.T) {
+	if _, err := NewPaginator(nil); !errors.Is(err, ErrEmptySecret) {
+		t.Errorf("NewPaginator(nil) error = %v, want %v", err, ErrEmptySecret)
+	}
+	if _, err := Paginate[pageItem](t.Context(), nil, Paginator{}, KeysetQuery{
+		OrderBy: []SortColumn{{Column: "id"}},
+	}); !errors.Is(err, ErrEmptySecret) {
+		t.Errorf("Paginate with zero Paginator error = %v, want %v", err, ErrEmptySecret)
+	}
+}
+
+func TestPaginateOffsetRequiresOrderBy(t *testing.T) {
+	_, err := PaginateOffset[pageItem](t.Context(), nil, OffsetQuery{Query: "select * from items"})
+	if !errors.Is(err, ErrNoSortColumns) {
+		t.Errorf("PaginateOffset without OrderBy error = %v, want %v", err, ErrNoSortColumns)
+	}
+}
+
+func TestCursor(t *testing.T) {
+	const query = "select * from items where owner = $1"
+	orderBy := []SortColumn{{Column: "created_at", Desc: true}, {Column: "id"}}
+	item := pageItem{ID: 42, CreatedAt: time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC), Name: "x"}
+
+	columns, err := sortFields[pageItem](orderBy)
+	if err != nil {
+		t.Fatalf("sortFields: %v", err)
+	}
+	hash := func(args ...any) string {
+		h, err := queryHash(query, args)
+		if err != nil {
+			t.Fatalf("queryHash: %v", err)
+		}
+		return h
+	}
+
+	p := newTestPaginator(t, "secret")
+	token, err := p.encode(item, hash("alice"), orderBy, columns)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		p       Paginator
+		token   string
+		hash    string
+		orderBy []SortColumn
+		wantErr error
+	}{
+		{
+			name:    "round trip",
+			p:       p,
+			token:   token,
+			hash:    hash("alice"),
+			orderBy: orderBy,
+		},
+		{
+			name:    "tampered signature",
+			p:       p,
+			token:   tamper(t, token, 1),
+			hash:    hash("alice"),
+			orderBy: orderBy,
+			wantErr: ErrInvalidCursor,
+		},
+		{
+			name:    "tampered payload",
+			p:       p,
+			token:   tamper(t, token, 0),
+			hash:    hash("alice"),
+			orderBy: orderBy,
+			wantErr: ErrInvalidCursor,
+		},
+		{
+			name:    "no signature",
+			p:       p,
+			token:   strings.Split(token, ".")[0],
+			hash:    hash("alice"),
+			orderBy: orderBy,
+			wantErr: ErrInvalidCursor,
+		},
+		{
+			name:    "different secret",
+			p:       newTestPaginator(t, "other secret"),
+			token:   token,
+			hash:    hash("alice"),
+			orderBy: orderBy,
+			wantErr: ErrInvalidCursor,
+		},
+		{
+			name:    "different args",
+			p:       p,
+			token:   token,
+			hash:    hash("bob"),
+			orderBy: orderBy,
+			wantErr: ErrInvalidCursor,
+		},
+		{
+			name:    "changed direction",
+			p:       p,
+			token:   token,
+			hash:    hash("alice"),
+			orderBy: []SortColumn{{Column: "created_at"}, {Column: "id"}},
+			wantErr: ErrInvalidCursor,
+		},
+		{
+			name:    "changed columns",
+			p:       p,
+			token:   token,
+			hash:    hash("alice"),
+			orderBy: []SortColumn{{Column: "id"}, {Column: "created_at", Desc: true}},
+			wantErr: ErrInvalidCursor,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			columns, err := sortFields[pageItem](tt.orderBy)
+			if err != nil {
+				t.Fatalf("sortFields: %v", err)
+			}
+
+			values, err := tt.p.decode(tt.token, tt.hash, tt.orderBy, columns)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("decode error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+
+			if len(values) != 2 {
+				t.Fatalf("decoded %d values, want 2", len(values))
+			}
+			if createdAt, ok := values[0].(time.Time); !ok || !createdAt.Equal(item.CreatedAt) {
+				t.Errorf("decoded created_at = %v, want %v", values[0], item.CreatedAt)
+			}
+			if id, ok := values[1].(int64); !ok || id != item.ID {
+				t.Errorf("decoded id = %v, want %d", values[1], item.ID)
+			}
+		})
+	}
+}
+
+func TestQueryHash(t *testing.T) {
+	a, err := queryHash("select 1", []any{1})
+	if err != nil {
+		t.Fatalf("queryHash: %v", err)
+	}
+	for name, other := range map[string]struct {
+		query string
+		args  []any
+	}{
+		"query": {"select 2", []any{1}},
+		"args":  {"select 1", []any{2}},
+		"type":  {"select 1", []any{"1"}},
+	} {
+		b, err := queryHash(other.query, other.args)
+		if err != nil {
+			t.Fatalf("queryHash: %v", err)
+		}
+		if a == b {
+			t.Errorf("hash doesn't change with %s", name)
+		}
+	}
+}
+
+func TestKeysetCondition(t *testing.T) {
+	tests := []struct {
+		name      string
+		orderBy   []SortColumn
+		argOffset int
+		want      string
+	}{
+		{
+			name:    "single asc",
+			orderBy: []SortColumn{{Column: "id"}},
+			want:    `(("id" > $1))`,
+		},
+		{
+			name:    "single desc",
+			orderBy: []SortColumn{{Column: "id", Desc: true}},
+			want:    `(("id" < $1))`,
+		},
+		{
+			name:      "mixed after query args",
+			orderBy:   []SortColumn{{Column: "created_at", Desc: true}, {Column: "id"}},
+			argOffset: 2,
+			want:      `(("created_at" < $3) or ("created_at" = $3 and "id" > $4))`,
+		},
+		{
+			name:    "three columns",
+			orderBy: []SortColumn{{Column: "a"}, {Column: "b", Desc: true}, {Column: "c"}},
+			want:    `(("a" > $1) or ("a" = $1 and "b" < $2) or ("a" = $1 and "b" = $2 and "c" > $3))`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := keysetCondition(tt.orderBy, tt.argOffset); got != tt.want {
+				t.Errorf("keysetCondition() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
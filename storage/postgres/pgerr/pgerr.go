@@ -0,0 +1,156 @@
+// Package pgerr classifies postgres errors into sentinel and typed errors.
+// It depends only on pgconn, so packages checking errors don't pull in the pool, tracing and metrics.
+package pgerr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// SQLSTATE codes of classified errors.
+const (
+	codeUniqueViolation      = "23505"
+	codeForeignKeyViolation  = "23503"
+	codeNotNullViolation     = "23502"
+	codeCheckViolation       = "23514"
+	codeSerializationFailure = "40001"
+	codeDeadlockDetected     = "40P01"
+	codeQueryCanceled        = "57014"
+	codeAdminShutdown        = "57P01"
+	classConnectionException = "08"
+)
+
+var (
+	// ErrUniqueViolation is an error when a unique constraint is violated.
+	ErrUniqueViolation = errors.New("unique violation")
+	// ErrForeignKeyViolation is an error when a foreign key constraint is violated.
+	ErrForeignKeyViolation = errors.New("foreign key violation")
+	// ErrNotNullViolation is an error when null is written into a not null column.
+	ErrNotNullViolation = errors.New("not null violation")
+	// ErrCheckViolation is an error when a check constraint is violated.
+	ErrCheckViolation = errors.New("check violation")
+	// ErrSerializationFailure is an error when a transaction can't be serialized and should be retried.
+	ErrSerializationFailure = errors.New("serialization failure")
+	// ErrDeadlock is an error when a transaction was aborted to resolve a deadlock.
+	ErrDeadlock = errors.New("deadlock detected")
+	// ErrQueryCanceled is an error when a query was canceled by a timeout or a context cancellation.
+	ErrQueryCanceled = errors.New("query canceled")
+	// ErrConnectionLost is an error when a connection to postgres was lost.
+	ErrConnectionLost = errors.New("connection lost")
+)
+
+// Error is a classified postgres error.
+// It matches its Kind with errors.Is and unwraps to the original error, so *pgconn.PgError is available with errors.As.
+type Error struct {
+	// Kind is one of the sentinel errors of this package.
+	Kind error
+	// Code is the SQLSTATE code, empty for errors that don't come from the server.
+	Code string
+	// Constraint is the name of the violated constraint.
+	Constraint string
+	// Table is the name of the table the error relates to.
+	Table string
+	// Column is the name of the column the error relates to.
+	Column string
+	// Err is the original error.
+	Err error
+}
+
+// Error implements error interface.
+func (e *Error) Error() string {
+	if e.Constraint != "" {
+		return fmt.Sprintf("%s on constraint %s: %s", e.Kind, e.Constraint, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", e.Kind, e.Err)
+}
+
+// Is reports whether target is the kind of e.
+func (e *Error) Is(target error) bool {
+	return target == e.Kind //nolint:errorlint // sentinels are compared directly
+}
+
+// Unwrap returns the original error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Classify wraps err into *Error if it's a known postgres error, otherwise err is returned as is.
+func Classify(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var classified *Error
+	if errors.As(err, &classified) {
+		return err
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		kind := pgErrorKind(pgErr.Code)
+		if kind == nil {
+			return err
+		}
+		return &Error{
+			Kind:       kind,
+			Code:       pgErr.Code,
+			Constraint: pgErr.ConstraintName,
+			Table:      pgErr.TableName,
+			Column:     pgErr.ColumnName,
+			Err:        err,
+		}
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return &Error{Kind: ErrQueryCanceled, Err: err}
+	case isConnectionError(err):
+		return &Error{Kind: ErrConnectionLost, Err: err}
+	default:
+		return err
+	}
+}
+
+func pgErrorKind(code string) error {
+	switch code {
+	case codeUniqueViolation:
+		return ErrUniqueViolation
+	case codeForeignKeyViolation:
+		return ErrForeignKeyViolation
+	case codeNotNullViolation:
+		return ErrNotNullViolation
+	case codeCheckViolation:
+		return ErrCheckViolation
+	case codeSerializationFailure:
+		return ErrSerializationFailure
+	case codeDeadlockDetected:
+		return ErrDeadlock
+	case codeQueryCanceled:
+		return ErrQueryCanceled
+	case codeAdminShutdown:
+		return ErrConnectionLost
+	}
+
+	if strings.HasPrefix(code, classConnectionException) {
+		return ErrConnectionLost
+	}
+	return nil
+}
+
+func isConnectionError(err error) bool {
+	var (
+		netErr     net.Error
+		connectErr *pgconn.ConnectError
+	)
+	return errors.As(err, &netErr) ||
+		errors.As(err, &connectErr) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed)
+}
@@ -5,12 +5,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
+	"strconv"
 	"time"
 
 	"github.com/georgysavva/scany/v2/pgxscan"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/yogenyslav/pkg/storage"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -20,6 +23,18 @@ type contextKey uint8
 const (
 	// TxKey is a key for the transaction stored in context.
 	TxKey contextKey = iota
+	// routingKey is a key for read routing options stored in context.
+	routingKey
+	// queryTraceKey is a key for the span of a query traced by pgx.
+	queryTraceKey
+	// queryNameKey is a key for the query name used in metrics.
+	queryNameKey
+	// tenantKey is a key for the tenant stored in context.
+	tenantKey
+	// actorKey is a key for the audit actor stored in context.
+	actorKey
+	// methodKey is a key for the Postgres method name used in metrics.
+	methodKey
 )
 
 var (
@@ -31,15 +46,95 @@ var (
 
 // Postgres wraps pgxpool.Pool and adds tracer to all operations.
 type Postgres struct {
-	pool   *pgxpool.Pool
-	tracer trace.Tracer
+	pool      *pgxpool.Pool
+	replicas  *replicaSet
+	tracer    trace.Tracer
+	metrics   *Metrics
+	tenancy   *tenancy
+	ambientTx bool
+	audit     bool
+}
+
+// querier is implemented by both pgxpool.Pool and pgx.Tx.
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+	CopyFrom(ctx context.Context, table pgx.Identifier, columns []string, src pgx.CopyFromSource) (int64, error)
 }
 
 // New creates a new Postgres instance.
-func New(cfg *Config, tracer trace.Tracer) (Postgres, error) {
-	pgConfig, err := pgxpool.ParseConfig(cfg.URL())
+// If cfg has replicas, Query and QuerySlice are routed to them, see WithPrimary and WithReadYourWrites.
+// If tracer is set, every query, batch, copy, connect and pool acquire gets its own span, see TracingConfig.
+func New(cfg *Config, tracer trace.Tracer, opts ...PostgresOpt) (Postgres, error) {
+	if err := cfg.validate(); err != nil {
+		return Postgres{}, err
+	}
+
+	pg := Postgres{
+		tracer: tracer,
+	}
+
+	if cfg.Tenancy.Enabled {
+		pg.tenancy = newTenancy(cfg.Tenancy)
+	}
+
+	for _, opt := range opts {
+		opt(&pg)
+	}
+
+	pool, err := pg.newPool(cfg, cfg.URL())
+	if err != nil {
+		return Postgres{}, err
+	}
+	pg.pool = pool
+
+	if len(cfg.Replicas) > 0 {
+		pools := make([]*pgxpool.Pool, 0, len(cfg.Replicas))
+		for _, replica := range cfg.Replicas {
+			replicaPool, err := pg.newPool(cfg, cfg.replicaURL(replica))
+			if err != nil {
+				for _, p := range pools {
+					p.Close()
+				}
+				pool.Close()
+				return Postgres{}, fmt.Errorf("replica %s: %w", replica.Host, err)
+			}
+			pools = append(pools, replicaPool)
+		}
+		pg.replicas = newReplicaSet(pools, cfg.ReplicaBalancer, time.Second*time.Duration(cfg.ReplicaHealthCheckSec))
+	}
+
+	if pg.metrics != nil {
+		if err = pg.addMetricsPools(cfg); err != nil {
+			pg.Close()
+			return Postgres{}, err
+		}
+	}
+
+	return pg, nil
+}
+
+// addMetricsPools adds stats of the primary and replica pools to metrics.
+func (pg Postgres) addMetricsPools(cfg *Config) error {
+	if err := pg.metrics.addPool(cfg.metricsPool(), pg.pool); err != nil {
+		return err
+	}
+	for i, replica := range cfg.Replicas {
+		name := cfg.metricsPool() + "/" + net.JoinHostPort(replica.Host, replica.Port)
+		if err := pg.metrics.addPool(name, pg.replicas.replicas[i].pool); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newPool creates a pgx pool for the conn string applying settings from cfg.
+func (pg Postgres) newPool(cfg *Config, connString string) (*pgxpool.Pool, error) {
+	pgConfig, err := pgxpool.ParseConfig(connString)
 	if err != nil {
-		return Postgres{}, fmt.Errorf("parse postgres connection string: %w", err)
+		return nil, fmt.Errorf("parse postgres connection string: %w", err)
 	}
 
 	// set few connection options
@@ -47,17 +142,43 @@ func New(cfg *Config, tracer trace.Tracer) (Postgres, error) {
 	pgConfig.ConnConfig.ValidateConnect = func(ctx context.Context, conn *pgconn.PgConn) error {
 		return conn.Ping(ctx)
 	}
+	if cfg.StatementTimeoutMs > 0 {
+		pgConfig.ConnConfig.RuntimeParams["statement_timeout"] = strconv.Itoa(cfg.StatementTimeoutMs)
+	}
+	if cfg.SearchPath != "" {
+		pgConfig.ConnConfig.RuntimeParams["search_path"] = cfg.SearchPath
+	}
+	if pg.tracer != nil || pg.metrics != nil || cfg.Tracing.SlowQueryMs > 0 {
+		pgConfig.ConnConfig.Tracer = newQueryTracer(pg.tracer, pg.metrics, pgConfig.ConnConfig, cfg.Tracing)
+	}
+
+	// set pool options
+	if pg.tenancy != nil {
+		pgConfig.BeforeAcquire = pg.tenancy.beforeAcquire
+		pgConfig.AfterRelease = pg.tenancy.afterRelease
+	}
+	if cfg.Pool.MaxConns > 0 {
+		pgConfig.MaxConns = cfg.Pool.MaxConns
+	}
+	if cfg.Pool.MinConns > 0 {
+		pgConfig.MinConns = cfg.Pool.MinConns
+	}
+	if cfg.Pool.MaxConnLifetimeSec > 0 {
+		pgConfig.MaxConnLifetime = time.Second * time.Duration(cfg.Pool.MaxConnLifetimeSec)
+	}
+	if cfg.Pool.MaxConnIdleTimeSec > 0 {
+		pgConfig.MaxConnIdleTime = time.Second * time.Duration(cfg.Pool.MaxConnIdleTimeSec)
+	}
+	if cfg.Pool.HealthCheckPeriodSec > 0 {
+		pgConfig.HealthCheckPeriod = time.Second * time.Duration(cfg.Pool.HealthCheckPeriodSec)
+	}
 
 	// create pgx pool for postgres
 	pool, err := pgxpool.NewWithConfig(context.Background(), pgConfig)
 	if err != nil {
-		return Postgres{}, fmt.Errorf("connect to postgres: %w", err)
+		return nil, fmt.Errorf("connect to postgres: %w", err)
 	}
-
-	return Postgres{
-		pool:   pool,
-		tracer: tracer,
-	}, nil
+	return pool, nil
 }
 
 // GetPool returns the underlying pgxpool.Pool.
@@ -67,7 +188,70 @@ func (pg Postgres) GetPool() *pgxpool.Pool {
 
 // Close closes the underlying db connection.
 func (pg Postgres) Close() {
+	if pg.replicas != nil {
+		pg.replicas.close()
+		if pg.metrics != nil {
+			for _, r := range pg.replicas.replicas {
+				pg.metrics.removePools(r.pool)
+			}
+		}
+	}
 	pg.pool.Close()
+	if pg.metrics != nil {
+		pg.metrics.removePools(pg.pool)
+	}
+}
+
+func (pg Postgres) trace(
+	ctx context.Context,
+	spanName string,
+	attrs ...attribute.KeyValue,
+) (context.Context, trace.Span) {
+	if pg.tracer == nil {
+		return ctx, trace.SpanFromContext(ctx)
+	}
+
+	ctx, span := pg.tracer.Start(ctx, spanName, trace.WithAttributes(attrs...))
+	return ctx, span
+}
+
+// querier returns the transaction from ctx if there is one, otherwise the pool.
+func (pg Postgres) querier(ctx context.Context) querier {
+	if tx, ok := ctx.Value(TxKey).(pgx.Tx); ok {
+		return tx
+	}
+	return pg.poolQuerier(ctx, pg.pool)
+}
+
+// defaultQuerier returns the querier for methods without the Tx suffix,
+// which only use the transaction from ctx when ambient transactions are enabled.
+func (pg Postgres) defaultQuerier(ctx context.Context) querier {
+	if pg.ambientTx {
+		return pg.querier(ctx)
+	}
+	return pg.poolQuerier(ctx, pg.pool)
+}
+
+// poolQuerier returns pool, or a querier failing every query if ctx has no tenant required by pg.
+func (pg Postgres) poolQuerier(ctx context.Context, pool *pgxpool.Pool) querier {
+	if err := pg.checkTenant(ctx); err != nil {
+		return failingQuerier{err: err}
+	}
+	return pool
+}
+
+// readQuerier returns the querier for Query and QuerySlice:
+// the ambient transaction if there is one, the primary if ctx holds a tx or requires it,
+// a healthy replica otherwise.
+func (pg Postgres) readQuerier(ctx context.Context) querier {
+	if _, inTx := ctx.Value(TxKey).(pgx.Tx); inTx || pg.replicas == nil || usePrimary(ctx) {
+		return pg.defaultQuerier(ctx)
+	}
+
+	if replica := pg.replicas.pick(); replica != nil {
+		return pg.poolQuerier(ctx, replica)
+	}
+	return pg.poolQuerier(ctx, pg.pool)
 }
 
 // GetTx returns a transaction from ctx or an error if there is no tx.
@@ -79,7 +263,54 @@ func (pg Postgres) GetTx(ctx context.Context) (pgx.Tx, error) {
 	return tx, nil
 }
 
+// Begin starts a new transaction with the given options.
+// If ctx already holds a transaction, a savepoint is created in it instead and opts are ignored.
+func (pg Postgres) Begin(ctx context.Context, opts storage.TxOptions) (context.Context, error) {
+	parent, nested := ctx.Value(TxKey).(pgx.Tx)
+
+	ctx, span := pg.trace(
+		ctx,
+		"Postgres.Begin",
+		attribute.String("isolation_level", string(opts.IsoLevel)),
+		attribute.String("access_mode", string(opts.AccessMode)),
+		attribute.Bool("savepoint", nested),
+	)
+	defer span.End()
+
+	if nested {
+		tx, err := parent.Begin(ctx)
+		if err != nil {
+			return ctx, fmt.Errorf("create savepoint: %w", Classify(err))
+		}
+		if err = pg.setActor(ctx, tx); err != nil {
+			_ = tx.Rollback(ctx)
+			return ctx, err
+		}
+		return context.WithValue(ctx, TxKey, tx), nil
+	}
+
+	if err := pg.checkTenant(ctx); err != nil {
+		return ctx, fmt.Errorf("starting a tx failed: %w", err)
+	}
+
+	tx, err := pg.pool.BeginTx(ctx, pgx.TxOptions{
+		IsoLevel:       opts.IsoLevel,
+		AccessMode:     opts.AccessMode,
+		DeferrableMode: opts.DeferrableMode,
+	})
+	if err != nil {
+		return ctx, fmt.Errorf("starting a tx failed: %w", Classify(err))
+	}
+	if err = pg.setActor(ctx, tx); err != nil {
+		_ = tx.Rollback(ctx)
+		return ctx, err
+	}
+
+	return context.WithValue(ctx, TxKey, tx), nil
+}
+
 // BeginSerializable starts a new transaction with serializable isolation level.
+// If ctx already holds a transaction, a savepoint is created in it instead.
 func (pg Postgres) BeginSerializable(ctx context.Context) (context.Context, error) {
 	if pg.tracer != nil {
 		var span trace.Span
@@ -87,7 +318,7 @@ func (pg Postgres) BeginSerializable(ctx context.Context) (context.Context, erro
 		defer span.End()
 	}
 
-	tx, err := pg.pool.BeginTx(ctx, pgx.TxOptions{
+	ctx, err := pg.Begin(ctx, storage.TxOptions{
 		IsoLevel:   pgx.Serializable,
 		AccessMode: pgx.ReadWrite,
 	})
@@ -95,10 +326,11 @@ func (pg Postgres) BeginSerializable(ctx context.Context) (context.Context, erro
 		return ctx, fmt.Errorf("starting a serializable tx failed: %w", err)
 	}
 
-	return context.WithValue(ctx, TxKey, tx), nil
+	return ctx, nil
 }
 
 // CommitTx commits the transaction.
+// For a savepoint created by a nested Begin, the savepoint is released.
 func (pg Postgres) CommitTx(ctx context.Context) error {
 	if pg.tracer != nil {
 		var span trace.Span
@@ -112,12 +344,13 @@ func (pg Postgres) CommitTx(ctx context.Context) error {
 	}
 
 	if err = tx.Commit(ctx); err != nil {
-		return fmt.Errorf("failed to commit transaction: %w", err)
+		return fmt.Errorf("failed to commit transaction: %w", Classify(err))
 	}
 	return nil
 }
 
 // RollbackTx rolls back the transaction.
+// For a savepoint created by a nested Begin, the transaction is rolled back to the savepoint.
 func (pg Postgres) RollbackTx(ctx context.Context) error {
 	if pg.tracer != nil {
 		var span trace.Span
@@ -132,13 +365,15 @@ func (pg Postgres) RollbackTx(ctx context.Context) error {
 
 	if err = tx.Rollback(ctx); err != nil {
 		if !errors.Is(err, pgx.ErrTxClosed) {
-			return fmt.Errorf("failed to rollback transaction: %w", err)
+			return fmt.Errorf("failed to rollback transaction: %w", Classify(err))
 		}
 	}
 	return nil
 }
 
 // Query executes a query that returns a single row.
+// With WithAmbientTx option it runs in the transaction from ctx if there is one.
+// Otherwise it runs on a replica if there are any, unless ctx requires the primary.
 func (pg Postgres) Query(ctx context.Context, dest any, query string, args ...any) error {
 	if pg.tracer != nil {
 		var span trace.Span
@@ -149,14 +384,17 @@ func (pg Postgres) Query(ctx context.Context, dest any, query string, args ...an
 		)
 		defer span.End()
 	}
+	ctx = pg.withMethod(ctx, "Query")
 
-	if err := pgxscan.Get(ctx, pg.pool, dest, query, args...); err != nil {
-		return fmt.Errorf("failed to get row: %w", err)
+	if err := pgxscan.Get(ctx, pg.readQuerier(ctx), dest, query, args...); err != nil {
+		return fmt.Errorf("failed to get row: %w", Classify(err))
 	}
 	return nil
 }
 
 // QuerySlice executes a query that returns multiple rows.
+// With WithAmbientTx option it runs in the transaction from ctx if there is one.
+// Otherwise it runs on a replica if there are any, unless ctx requires the primary.
 func (pg Postgres) QuerySlice(ctx context.Context, dest any, query string, args ...any) error {
 	if pg.tracer != nil {
 		var span trace.Span
@@ -167,14 +405,16 @@ func (pg Postgres) QuerySlice(ctx context.Context, dest any, query string, args
 		)
 		defer span.End()
 	}
+	ctx = pg.withMethod(ctx, "QuerySlice")
 
-	if err := pgxscan.Select(ctx, pg.pool, dest, query, args...); err != nil {
-		return fmt.Errorf("failed to get rows: %w", err)
+	if err := pgxscan.Select(ctx, pg.readQuerier(ctx), dest, query, args...); err != nil {
+		return fmt.Errorf("failed to get rows: %w", Classify(err))
 	}
 	return nil
 }
 
 // Exec executes a query that doesn't return any rows.
+// With WithAmbientTx option it runs in the transaction from ctx if there is one.
 func (pg Postgres) Exec(ctx context.Context, query string, args ...any) (int64, error) {
 	if pg.tracer != nil {
 		var span trace.Span
@@ -185,10 +425,13 @@ func (pg Postgres) Exec(ctx context.Context, query string, args ...any) (int64,
 		)
 		defer span.End()
 	}
+	ctx = pg.withMethod(ctx, "Exec")
 
-	tag, err := pg.pool.Exec(ctx, query, args...)
+	markWrite(ctx)
+
+	tag, err := pg.defaultQuerier(ctx).Exec(ctx, query, args...)
 	if err != nil {
-		return 0, fmt.Errorf("failed to exec: %w", err)
+		return 0, fmt.Errorf("failed to exec: %w", Classify(err))
 	}
 	return tag.RowsAffected(), nil
 }
@@ -204,6 +447,7 @@ func (pg Postgres) QueryTx(ctx context.Context, dest any, query string, args ...
 		)
 		defer span.End()
 	}
+	ctx = pg.withMethod(ctx, "QueryTx")
 
 	tx, err := pg.GetTx(ctx)
 	if err != nil {
@@ -211,7 +455,7 @@ func (pg Postgres) QueryTx(ctx context.Context, dest any, query string, args ...
 	}
 
 	if err = pgxscan.Get(ctx, tx, dest, query, args...); err != nil {
-		return fmt.Errorf("failed to get row in transaction: %w", err)
+		return fmt.Errorf("failed to get row in transaction: %w", Classify(err))
 	}
 	return nil
 }
@@ -232,6 +476,7 @@ func (pg Postgres) QuerySliceTx(
 		)
 		defer span.End()
 	}
+	ctx = pg.withMethod(ctx, "QuerySliceTx")
 
 	tx, err := pg.GetTx(ctx)
 	if err != nil {
@@ -239,7 +484,7 @@ func (pg Postgres) QuerySliceTx(
 	}
 
 	if err = pgxscan.Select(ctx, tx, dest, query, args...); err != nil {
-		return fmt.Errorf("failed to get rows in transaction: %w", err)
+		return fmt.Errorf("failed to get rows in transaction: %w", Classify(err))
 	}
 	return nil
 }
@@ -255,15 +500,18 @@ func (pg Postgres) ExecTx(ctx context.Context, query string, args ...any) (int64
 		)
 		defer span.End()
 	}
+	ctx = pg.withMethod(ctx, "ExecTx")
 
 	tx, err := pg.GetTx(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("get transaction: %w", err)
 	}
 
+	markWrite(ctx)
+
 	tag, err := tx.Exec(ctx, query, args...)
 	if err != nil {
-		return 0, fmt.Errorf("failed to exec in transaction: %w", err)
+		return 0, fmt.Errorf("failed to exec in transaction: %w", Classify(err))
 	}
 	return tag.RowsAffected(), nil
 }
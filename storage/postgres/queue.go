@@ -0,0 +1,424 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultQueueTable        = "jobs"
+	defaultQueueWorkers      = 4
+	defaultQueuePollInterval = time.Second
+	defaultVisibilityTimeout = 5 * time.Minute
+	defaultMaxAttempts       = 5
+	defaultJobBackoffBase    = time.Second
+	defaultJobBackoffMax     = time.Hour
+)
+
+var (
+	// ErrDuplicateJob is an error when a job with the same unique key is already pending or running.
+	ErrDuplicateJob = errors.New("job with the same unique key already exists")
+	// ErrJobNotFound is an error when a job doesn't exist or isn't in the expected state.
+	ErrJobNotFound = errors.New("job not found")
+	// ErrNoJobHandler is an error when a claimed job has no registered handler.
+	ErrNoJobHandler = errors.New("no handler for job kind")
+	// ErrMaxAttemptsExceeded is an error when a reclaimed job has already used all its attempts.
+	ErrMaxAttemptsExceeded = errors.New("job exceeded max attempts")
+	// ErrJobPanicked is an error when a job handler panics.
+	ErrJobPanicked = errors.New("job handler panicked")
+	// ErrJobLeaseLost is an error when a job was reclaimed by another worker before its result was recorded.
+	ErrJobLeaseLost = errors.New("job lease lost")
+)
+
+// JobStatus is a state of a job in the queue.
+type JobStatus string
+
+const (
+	// JobPending is a job waiting to be run.
+	JobPending JobStatus = "pending"
+	// JobRunning is a job claimed by a worker.
+	JobRunning JobStatus = "running"
+	// JobDone is a successfully finished job.
+	JobDone JobStatus = "done"
+	// JobDead is a job that failed max attempts times.
+	JobDead JobStatus = "dead"
+)
+
+// Job is a job claimed by a worker.
+type Job struct {
+	ID          int64             `db:"id"`
+	Kind        string            `db:"kind"`
+	Payload     json.RawMessage   `db:"payload"`
+	Attempt     int               `db:"attempts"`
+	MaxAttempts int               `db:"max_attempts"`
+	Trace       map[string]string `db:"trace_context"`
+}
+
+// JobHandler handles jobs of a single kind. A returned error schedules a retry.
+type JobHandler func(ctx context.Context, job Job) error
+
+// EnqueueOpts are options of an enqueued job.
+type EnqueueOpts struct {
+	// RunAt is the earliest time the job may run at, now if zero.
+	RunAt time.Time
+	// MaxAttempts overrides QueueConfig.MaxAttempts.
+	MaxAttempts int
+	// UniqueKey prevents enqueueing another job with the same key while this one is pending or running.
+	UniqueKey string
+}
+
+// QueueConfig is the configuration for a job queue, defaults are used for zero values.
+type QueueConfig struct {
+	// Table is a table for jobs, "jobs" by default.
+	Table string
+	// Workers is a number of jobs processed concurrently, 4 by default.
+	Workers int
+	// PollInterval is how often idle workers look for new jobs, 1 second by default.
+	PollInterval time.Duration
+	// VisibilityTimeout is how long a job may run before another worker reclaims it, 5 minutes by default.
+	VisibilityTimeout time.Duration
+	// MaxAttempts is how many times a job is run before it's moved to the dead state, 5 by default.
+	MaxAttempts int
+	// Backoff returns a delay before the given retry attempt, exponential from 1 second to 1 hour by default.
+	Backoff func(attempt int) time.Duration
+}
+
+// Queue is a durable job queue stored in a postgres table.
+// Workers claim jobs with SELECT ... FOR UPDATE SKIP LOCKED, so any number of them may run concurrently.
+type Queue struct {
+	pg       Postgres
+	cfg      QueueConfig
+	table    string
+	mu       sync.RWMutex
+	handlers map[string]JobHandler
+}
+
+// NewQueue creates a new Queue.
+func NewQueue(pg Postgres, cfg QueueConfig) *Queue {
+	if cfg.Table == "" {
+		cfg.Table = defaultQueueTable
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaultQueueWorkers
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultQueuePollInterval
+	}
+	if cfg.VisibilityTimeout <= 0 {
+		cfg.VisibilityTimeout = defaultVisibilityTimeout
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+	if cfg.Backoff == nil {
+		cfg.Backoff = ExponentialBackoff(defaultJobBackoffBase, defaultJobBackoffMax)
+	}
+
+	return &Queue{
+		pg:       pg,
+		cfg:      cfg,
+		table:    pgx.Identifier(strings.Split(cfg.Table, ".")).Sanitize(),
+		handlers: make(map[string]JobHandler),
+	}
+}
+
+// CreateTable creates the jobs table and its indexes if they don't exist.
+func (q *Queue) CreateTable(ctx context.Context) error {
+	ctx, span := q.pg.trace(ctx, "Queue.CreateTable")
+	defer span.End()
+
+	indexPrefix := pgx.Identifier{strings.ReplaceAll(q.cfg.Table, ".", "_")}
+	_, err := q.pg.querier(ctx).Exec(ctx, `
+		create table if not exists `+q.table+` (
+			id bigserial primary key,
+			kind text not null,
+			payload jsonb not null,
+			status text not null default 'pending',
+			attempts int not null default 0,
+			max_attempts int not null,
+			run_at timestamptz not null default now(),
+			locked_until timestamptz,
+			unique_key text,
+			last_error text,
+			trace_context jsonb not null default '{}',
+			created_at timestamptz not null default now(),
+			updated_at timestamptz not null default now()
+		);
+		create unique index if not exists `+pgx.Identifier{indexPrefix[0] + "_unique_key"}.Sanitize()+`
+			on `+q.table+` (unique_key) where unique_key is not null and status in ('pending', 'running');
+		create index if not exists `+pgx.Identifier{indexPrefix[0] + "_fetch"}.Sanitize()+`
+			on `+q.table+` (kind, run_at) where status in ('pending', 'running');
+	`)
+	if err != nil {
+		desc := "failed to create jobs table"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, desc)
+		return fmt.Errorf("%s: %w", desc, Classify(err))
+	}
+	return nil
+}
+
+// HandleFunc registers a handler for jobs of kind. Handlers must be registered before Run.
+func (q *Queue) HandleFunc(kind string, handler JobHandler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.handlers[kind] = handler
+}
+
+// Handle registers a handler for jobs of kind with payload decoded into T.
+func Handle[T any](q *Queue, kind string, handler func(ctx context.Context, payload T) error) {
+	q.HandleFunc(kind, func(ctx context.Context, job Job) error {
+		var payload T
+		if err := json.Unmarshal(job.Payload, &payload); err != nil {
+			return fmt.Errorf("unmarshal job payload: %w", err)
+		}
+		return handler(ctx, payload)
+	})
+}
+
+// Enqueue adds a job of kind with payload marshaled to JSON, in the transaction from ctx if there is one,
+// so the job becomes visible to workers only after commit.
+//
+// Returns id of the job or ErrDuplicateJob if a job with the same unique key is pending or running.
+func (q *Queue) Enqueue(ctx context.Context, kind string, payload any, opts EnqueueOpts) (int64, error) {
+	ctx, span := q.pg.trace(ctx, "Queue.Enqueue", attribute.String("kind", kind))
+	defer span.End()
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("marshal job payload: %w", err)
+	}
+
+	maxAttempts := opts.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = q.cfg.MaxAttempts
+	}
+	runAt := opts.RunAt
+	if runAt.IsZero() {
+		runAt = time.Now()
+	}
+	var uniqueKey *string
+	if opts.UniqueKey != "" {
+		uniqueKey = &opts.UniqueKey
+	}
+
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+
+	var id int64
+	err = q.pg.querier(ctx).QueryRow(ctx, `
+		insert into `+q.table+` (kind, payload, max_attempts, run_at, unique_key, trace_context)
+		values ($1, $2, $3, $4, $5, $6)
+		on conflict (unique_key) where unique_key is not null and status in ('pending', 'running') do nothing
+		returning id`,
+		kind, data, maxAttempts, runAt, uniqueKey, map[string]string(carrier),
+	).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("enqueue %s: %w", kind, ErrDuplicateJob)
+	}
+	if err != nil {
+		desc := "failed to enqueue job"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, desc)
+		return 0, fmt.Errorf("%s: %w", desc, Classify(err))
+	}
+
+	span.SetAttributes(attribute.Int64("job_id", id))
+	return id, nil
+}
+
+// Requeue moves a dead job back to the pending state with a fresh attempts counter.
+func (q *Queue) Requeue(ctx context.Context, id int64) error {
+	ctx, span := q.pg.trace(ctx, "Queue.Requeue", attribute.Int64("job_id", id))
+	defer span.End()
+
+	tag, err := q.pg.querier(ctx).Exec(ctx, `
+		update `+q.table+`
+		set status = 'pending', attempts = 0, run_at = now(), updated_at = now()
+		where id = $1 and status = 'dead'`,
+		id,
+	)
+	if err != nil {
+		desc := "failed to requeue job"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, desc)
+		return fmt.Errorf("%s: %w", desc, Classify(err))
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("requeue job %d: %w", id, ErrJobNotFound)
+	}
+	return nil
+}
+
+// Run starts workers that process jobs until ctx is canceled and waits for them to finish.
+func (q *Queue) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for range q.cfg.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+// work claims and processes jobs one by one, sleeping for the poll interval when there are none.
+func (q *Queue) work(ctx context.Context) {
+	for {
+		job, found, err := q.claim(ctx)
+		if err == nil && found {
+			q.process(ctx, job)
+			continue
+		}
+
+		timer := time.NewTimer(q.cfg.PollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// claim locks the next due job of a registered kind, including running jobs whose visibility timeout expired.
+func (q *Queue) claim(ctx context.Context) (Job, bool, error) {
+	q.mu.RLock()
+	kinds := make([]string, 0, len(q.handlers))
+	for kind := range q.handlers {
+		kinds = append(kinds, kind)
+	}
+	q.mu.RUnlock()
+
+	if len(kinds) == 0 {
+		return Job{}, false, nil
+	}
+
+	rows, err := q.pg.poolQuerier(ctx, q.pg.pool).Query(ctx, `
+		update `+q.table+`
+		set status = 'running', attempts = attempts + 1, locked_until = now() + $2::interval, updated_at = now()
+		where id = (
+			select id from `+q.table+`
+			where kind = any($1)
+				and ((status = 'pending' and run_at <= now()) or (status = 'running' and locked_until < now()))
+			order by run_at
+			limit 1
+			for update skip locked
+		)
+		returning id, kind, payload, attempts, max_attempts, trace_context`,
+		kinds, q.cfg.VisibilityTimeout,
+	)
+	if err != nil {
+		return Job{}, false, fmt.Errorf("claim job: %w", Classify(err))
+	}
+
+	job, err := pgx.CollectExactlyOneRow(rows, pgx.RowToStructByName[Job])
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Job{}, false, nil
+	}
+	if err != nil {
+		return Job{}, false, fmt.Errorf("claim job: %w", Classify(err))
+	}
+	return job, true, nil
+}
+
+// process runs the handler for job and records the result.
+func (q *Queue) process(ctx context.Context, job Job) {
+	jobCtx, span := q.pg.trace(
+		ctx,
+		"Queue.Job",
+		attribute.Int64("job_id", job.ID),
+		attribute.String("kind", job.Kind),
+		attribute.Int("attempt", job.Attempt),
+	)
+	defer span.End()
+
+	// link the job to the trace it was enqueued in
+	enqueuedCtx := propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier(job.Trace))
+	if spanCtx := trace.SpanContextFromContext(enqueuedCtx); spanCtx.IsValid() {
+		span.AddLink(trace.Link{SpanContext: spanCtx})
+	}
+
+	var err error
+	if job.Attempt > job.MaxAttempts {
+		err = fmt.Errorf("job %d: %w", job.ID, ErrMaxAttemptsExceeded)
+	} else {
+		err = q.run(jobCtx, job)
+	}
+
+	// the result is recorded even if ctx was canceled during the run,
+	// updates match the claimed attempt, so a worker that lost the lease doesn't overwrite the new one
+	resultCtx := context.WithoutCancel(jobCtx)
+	var tag pgconn.CommandTag
+	if err == nil {
+		tag, err = q.pg.poolQuerier(resultCtx, q.pg.pool).Exec(resultCtx, `
+			update `+q.table+`
+			set status = 'done', locked_until = null, last_error = null, updated_at = now()
+			where id = $1 and status = 'running' and attempts = $2`,
+			job.ID, job.Attempt,
+		)
+		if err == nil && tag.RowsAffected() == 0 {
+			err = fmt.Errorf("complete job %d: %w", job.ID, ErrJobLeaseLost)
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "failed to complete job")
+		}
+		return
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, "job failed")
+
+	status := JobPending
+	if job.Attempt >= job.MaxAttempts {
+		status = JobDead
+	}
+	tag, err = q.pg.poolQuerier(resultCtx, q.pg.pool).Exec(resultCtx, `
+		update `+q.table+`
+		set status = $3, run_at = now() + $4::interval, locked_until = null, last_error = $5, updated_at = now()
+		where id = $1 and status = 'running' and attempts = $2`,
+		job.ID, job.Attempt, status, q.cfg.Backoff(job.Attempt), err.Error(),
+	)
+	if err == nil && tag.RowsAffected() == 0 {
+		err = fmt.Errorf("retry job %d: %w", job.ID, ErrJobLeaseLost)
+	}
+	if err != nil {
+		span.RecordError(err)
+	}
+}
+
+// run calls the handler for job within the visibility timeout, recovering from panics.
+func (q *Queue) run(ctx context.Context, job Job) (err error) {
+	q.mu.RLock()
+	handler, ok := q.handlers[job.Kind]
+	q.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w %s", ErrNoJobHandler, job.Kind)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, q.cfg.VisibilityTimeout)
+	defer cancel()
+
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("%w: %v", ErrJobPanicked, p)
+		}
+	}()
+
+	return handler(ctx, job)
+}
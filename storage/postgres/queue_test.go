@@ -0,0 +1,123 @@
+package postgres_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/yogenyslav/pkg/storage/postgres"
+	"github.com/yogenyslav/pkg/storage/storagetest"
+)
+
+type jobState struct {
+	Status    string `db:"status"`
+	Attempts  int    `db:"attempts"`
+	LastError string `db:"last_error"`
+}
+
+func TestQueueLeaseExpiresDuringHandler(t *testing.T) {
+	pg := storagetest.NewPostgres(t)
+	ctx := t.Context()
+
+	const (
+		table      = "jobs_lease_test"
+		visibility = 500 * time.Millisecond
+	)
+	dropTable := func() {
+		if _, err := pg.Exec(context.WithoutCancel(ctx), "drop table if exists "+table); err != nil {
+			t.Errorf("drop table: %v", err)
+		}
+	}
+	dropTable()
+	t.Cleanup(dropTable)
+
+	q := postgres.NewQueue(pg, postgres.QueueConfig{
+		Table:             table,
+		Workers:           2,
+		PollInterval:      20 * time.Millisecond,
+		VisibilityTimeout: visibility,
+		Backoff:           func(int) time.Duration { return time.Hour },
+	})
+	if err := q.CreateTable(ctx); err != nil {
+		t.Fatalf("CreateTable: %v", err)
+	}
+
+	firstDone := make(chan struct{})
+	releaseSecond := make(chan struct{})
+	q.HandleFunc("lease", func(_ context.Context, job postgres.Job) error {
+		switch job.Attempt {
+		case 1:
+			// outlive the lease, so another worker reclaims the job
+			time.Sleep(visibility + 300*time.Millisecond)
+			close(firstDone)
+			return nil
+		case 2:
+			<-releaseSecond
+			return errors.New("second attempt failed")
+		default:
+			t.Errorf("unexpected attempt %d", job.Attempt)
+			return nil
+		}
+	})
+
+	id, err := q.Enqueue(ctx, "lease", struct{}{}, postgres.EnqueueOpts{})
+	if err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		q.Run(runCtx)
+	}()
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	getState := func() jobState {
+		t.Helper()
+
+		var state jobState
+		err := pg.Query(ctx, &state,
+			"select status, attempts, coalesce(last_error, '') as last_error from "+table+" where id = $1", id)
+		if err != nil {
+			t.Fatalf("get job state: %v", err)
+		}
+		return state
+	}
+
+	select {
+	case <-firstDone:
+	case <-time.After(5 * time.Second):
+		close(releaseSecond)
+		t.Fatal("first attempt didn't finish")
+	}
+	// give the stale worker time to record its result
+	time.Sleep(100 * time.Millisecond)
+
+	if state := getState(); state.Status != string(postgres.JobRunning) || state.Attempts != 2 {
+		t.Errorf("after the stale attempt finished: got %+v, want running attempt 2", state)
+	}
+
+	close(releaseSecond)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		state := getState()
+		if state.Status == string(postgres.JobPending) {
+			if state.Attempts != 2 || !strings.Contains(state.LastError, "second attempt failed") {
+				t.Errorf("after the second attempt failed: got %+v, want pending attempt 2 with its error", state)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("second attempt result wasn't recorded: %+v", state)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,155 @@
+package postgres
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// BalancerRoundRobin selects replicas in turn.
+	BalancerRoundRobin = "round_robin"
+	// BalancerLeastConns selects a replica with the least acquired connections.
+	BalancerLeastConns = "least_conns"
+
+	defaultReplicaHealthCheck = 5 * time.Second
+)
+
+// readRouting is stored in context to control where reads are routed.
+type readRouting struct {
+	primary bool
+	sticky  bool
+	// wrote is shared by routings derived from each other, so a write made with any of them is seen by all.
+	wrote *atomic.Bool
+}
+
+// WithPrimary marks ctx so that Query and QuerySlice made with it go to the primary instead of a replica.
+func WithPrimary(ctx context.Context) context.Context {
+	routing := routingFrom(ctx)
+	routing.primary = true
+	return context.WithValue(ctx, routingKey, routing)
+}
+
+// WithReadYourWrites marks ctx so that after the first Exec, ExecTx, SendBatch or CopyFrom made with it
+// or with a context derived from it, subsequent reads with the same ctx go to the primary and see the written data.
+// Writes made with Query or QuerySlice, e.g. insert ... returning, aren't detected:
+// they have to be made with WithPrimary and don't route later reads to the primary.
+func WithReadYourWrites(ctx context.Context) context.Context {
+	routing := routingFrom(ctx)
+	routing.sticky = true
+	return context.WithValue(ctx, routingKey, routing)
+}
+
+// routingFrom returns a copy of the read routing stored in ctx, so a new mark keeps the existing ones.
+// The copy shares the write mark with the original.
+func routingFrom(ctx context.Context) *readRouting {
+	if parent, ok := ctx.Value(routingKey).(*readRouting); ok {
+		routing := *parent
+		return &routing
+	}
+	return &readRouting{wrote: &atomic.Bool{}}
+}
+
+// usePrimary reports whether reads made with ctx must go to the primary.
+func usePrimary(ctx context.Context) bool {
+	routing, ok := ctx.Value(routingKey).(*readRouting)
+	return ok && (routing.primary || routing.wrote.Load())
+}
+
+// markWrite records a write for read-your-writes routing.
+func markWrite(ctx context.Context) {
+	if routing, ok := ctx.Value(routingKey).(*readRouting); ok && routing.sticky {
+		routing.wrote.Store(true)
+	}
+}
+
+type replica struct {
+	pool    *pgxpool.Pool
+	healthy atomic.Bool
+}
+
+// replicaSet balances reads between healthy replicas.
+type replicaSet struct {
+	replicas []*replica
+	balancer string
+	next     atomic.Uint64
+	cancel   context.CancelFunc
+}
+
+func newReplicaSet(pools []*pgxpool.Pool, balancer string, healthCheck time.Duration) *replicaSet {
+	if healthCheck <= 0 {
+		healthCheck = defaultReplicaHealthCheck
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rs := &replicaSet{
+		replicas: make([]*replica, len(pools)),
+		balancer: balancer,
+		cancel:   cancel,
+	}
+	for i, pool := range pools {
+		rs.replicas[i] = &replica{pool: pool}
+		rs.replicas[i].healthy.Store(true)
+	}
+
+	go rs.checkHealth(ctx, healthCheck)
+
+	return rs
+}
+
+// pick returns a healthy replica pool or nil if all replicas are unhealthy.
+func (rs *replicaSet) pick() *pgxpool.Pool {
+	if rs.balancer == BalancerLeastConns {
+		var (
+			best     *pgxpool.Pool
+			minConns int32
+		)
+		for _, r := range rs.replicas {
+			if !r.healthy.Load() {
+				continue
+			}
+			if conns := r.pool.Stat().AcquiredConns(); best == nil || conns < minConns {
+				best, minConns = r.pool, conns
+			}
+		}
+		return best
+	}
+
+	start := rs.next.Add(1)
+	for i := range uint64(len(rs.replicas)) {
+		r := rs.replicas[(start+i)%uint64(len(rs.replicas))]
+		if r.healthy.Load() {
+			return r.pool
+		}
+	}
+	return nil
+}
+
+// checkHealth pings replicas every period until ctx is canceled.
+func (rs *replicaSet) checkHealth(ctx context.Context, period time.Duration) {
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for _, r := range rs.replicas {
+			pingCtx, cancel := context.WithTimeout(ctx, period)
+			r.healthy.Store(r.pool.Ping(pingCtx) == nil)
+			cancel()
+		}
+	}
+}
+
+func (rs *replicaSet) close() {
+	rs.cancel()
+	for _, r := range rs.replicas {
+		r.pool.Close()
+	}
+}
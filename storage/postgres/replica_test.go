@@ -0,0 +1,43 @@
+package postgres
+
+import (
+	"context"
+	"testing"
+)
+
+type testCtxKey struct{}
+
+func TestReadRouting(t *testing.T) {
+	parent := WithReadYourWrites(t.Context())
+	derived := WithPrimary(context.WithValue(parent, testCtxKey{}, "span"))
+
+	if usePrimary(parent) {
+		t.Fatal("parent reads go to the primary before any write")
+	}
+	if !usePrimary(derived) {
+		t.Fatal("WithPrimary reads don't go to the primary")
+	}
+
+	markWrite(derived)
+	if !usePrimary(parent) {
+		t.Error("write made with a derived ctx isn't seen by the parent")
+	}
+
+	sibling := WithReadYourWrites(t.Context())
+	if usePrimary(sibling) {
+		t.Error("write is seen by an unrelated ctx")
+	}
+}
+
+func TestReadRoutingWithoutReadYourWrites(t *testing.T) {
+	ctx := t.Context()
+	primary := WithPrimary(ctx)
+
+	markWrite(primary)
+	if usePrimary(ctx) {
+		t.Error("WithPrimary changed routing of the parent ctx")
+	}
+	if usePrimary(WithReadYourWrites(ctx)) {
+		t.Error("write is recorded without WithReadYourWrites")
+	}
+}
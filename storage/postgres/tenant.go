@@ -0,0 +1,268 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"time"
+
+	"github.com/georgysavva/scany/v2/pgxscan"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+const (
+	defaultTenantSchemaPrefix = "tenant_"
+	// tenantResetTimeout limits resetting search_path of a released connection.
+	tenantResetTimeout = 5 * time.Second
+	// tenantScopedKey marks connections with search_path set for a tenant in pgconn.PgConn.CustomData.
+	tenantScopedKey = "tenant_scoped"
+)
+
+// ErrNoTenant is an error when a tenant-scoped Postgres is used with a context without a tenant.
+var ErrNoTenant = errors.New("no tenant in context")
+
+// TenancyConfig is the configuration for schema-per-tenant isolation.
+type TenancyConfig struct {
+	// Enabled sets search_path of every connection acquired with a tenant in context to the tenant schema.
+	Enabled bool `yaml:"enabled"`
+	// Required makes queries, transactions and queue workers fail with ErrNoTenant when context has no tenant.
+	// Advisory locks and notification channels are database-wide, so Lock, TryLock, Listen and ListenFunc
+	// don't require a tenant, neither does TenantProvisioner.Tenants listing all tenants.
+	Required bool `yaml:"required"`
+	// SchemaPrefix is prepended to a tenant id to get the tenant schema, "tenant_" by default.
+	SchemaPrefix string `yaml:"schema_prefix"`
+	// SharedSchemas are searched after the tenant schema, "public" by default.
+	SharedSchemas []string `yaml:"shared_schemas"`
+}
+
+// WithTenant sets the tenant for queries and transactions made with ctx.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey, tenant)
+}
+
+// Tenant returns the tenant set by WithTenant.
+func Tenant(ctx context.Context) (string, bool) {
+	tenant, ok := ctx.Value(tenantKey).(string)
+	return tenant, ok && tenant != ""
+}
+
+// tenancy sets search_path of pooled connections by the tenant from context.
+type tenancy struct {
+	cfg TenancyConfig
+}
+
+func newTenancy(cfg TenancyConfig) *tenancy {
+	if cfg.SchemaPrefix == "" {
+		cfg.SchemaPrefix = defaultTenantSchemaPrefix
+	}
+	if len(cfg.SharedSchemas) == 0 {
+		cfg.SharedSchemas = []string{"public"}
+	}
+	return &tenancy{cfg: cfg}
+}
+
+// schema returns the schema name of tenant.
+func (t *tenancy) schema(tenant string) string {
+	return t.cfg.SchemaPrefix + tenant
+}
+
+// searchPath returns search_path for tenant.
+func (t *tenancy) searchPath(tenant string) string {
+	schemas := make([]string, 0, len(t.cfg.SharedSchemas)+1)
+	schemas = append(schemas, pgx.Identifier{t.schema(tenant)}.Sanitize())
+	for _, schema := range t.cfg.SharedSchemas {
+		schemas = append(schemas, pgx.Identifier{schema}.Sanitize())
+	}
+	return strings.Join(schemas, ", ")
+}
+
+// beforeAcquire is pgxpool.Config.BeforeAcquire setting search_path for the tenant from ctx.
+func (t *tenancy) beforeAcquire(ctx context.Context, conn *pgx.Conn) bool {
+	tenant, ok := Tenant(ctx)
+	if !ok {
+		return true
+	}
+
+	// false makes the pool destroy the connection and acquire another one
+	if _, err := conn.Exec(ctx, "select set_config('search_path', $1, false)", t.searchPath(tenant)); err != nil {
+		return false
+	}
+	// the mark lives as long as the connection, so destroyed connections leave nothing behind
+	conn.PgConn().CustomData()[tenantScopedKey] = true
+	return true
+}
+
+// afterRelease is pgxpool.Config.AfterRelease resetting search_path set by beforeAcquire.
+func (t *tenancy) afterRelease(conn *pgx.Conn) bool {
+	data := conn.PgConn().CustomData()
+	if scoped, _ := data[tenantScopedKey].(bool); !scoped {
+		return true
+	}
+	delete(data, tenantScopedKey)
+
+	ctx, cancel := context.WithTimeout(context.Background(), tenantResetTimeout)
+	defer cancel()
+
+	// PgConn bypasses the query tracer, a reset on every release would only add root spans and metrics noise.
+	// false makes the pool destroy the connection, so it's never reused with another tenant's search_path
+	_, err := conn.PgConn().Exec(ctx, "reset search_path").ReadAll()
+	return err == nil
+}
+
+// checkTenant returns ErrNoTenant if pg requires a tenant and ctx has none.
+func (pg Postgres) checkTenant(ctx context.Context) error {
+	if pg.tenancy == nil || !pg.tenancy.cfg.Required {
+		return nil
+	}
+	if _, ok := Tenant(ctx); !ok {
+		return ErrNoTenant
+	}
+	return nil
+}
+
+// TenantSchema returns the schema name of tenant.
+func (pg Postgres) TenantSchema(tenant string) string {
+	if pg.tenancy == nil {
+		return defaultTenantSchemaPrefix + tenant
+	}
+	return pg.tenancy.schema(tenant)
+}
+
+// failingQuerier fails every query with err.
+type failingQuerier struct {
+	err error
+}
+
+func (q failingQuerier) Exec(context.Context, string, ...any) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, q.err
+}
+
+func (q failingQuerier) Query(context.Context, string, ...any) (pgx.Rows, error) {
+	return nil, q.err
+}
+
+func (q failingQuerier) QueryRow(context.Context, string, ...any) pgx.Row {
+	return failingRow(q)
+}
+
+func (q failingQuerier) SendBatch(context.Context, *pgx.Batch) pgx.BatchResults {
+	return failingBatchResults(q)
+}
+
+func (q failingQuerier) CopyFrom(context.Context, pgx.Identifier, []string, pgx.CopyFromSource) (int64, error) {
+	return 0, q.err
+}
+
+type failingRow struct {
+	err error
+}
+
+func (r failingRow) Scan(...any) error {
+	return r.err
+}
+
+type failingBatchResults struct {
+	err error
+}
+
+func (r failingBatchResults) Exec() (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, r.err
+}
+
+func (r failingBatchResults) Query() (pgx.Rows, error) {
+	return nil, r.err
+}
+
+func (r failingBatchResults) QueryRow() pgx.Row {
+	return failingRow(r)
+}
+
+func (r failingBatchResults) Close() error {
+	return r.err
+}
+
+// TenantProvisioner creates tenant schemas and applies migrations to them.
+type TenantProvisioner struct {
+	pg       Postgres
+	migrator *Migrator
+}
+
+// NewTenantProvisioner creates a new TenantProvisioner applying migrations from fsys to every tenant schema,
+// see NewMigrator. Migrations must not qualify tables with a schema, so they are created in the tenant schema.
+func NewTenantProvisioner(pg Postgres, fsys fs.FS, opts ...MigratorOpt) (*TenantProvisioner, error) {
+	migrator, err := NewMigrator(pg, fsys, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TenantProvisioner{
+		pg:       pg,
+		migrator: migrator,
+	}, nil
+}
+
+// Provision creates the schema for tenant if it doesn't exist and applies all pending migrations to it.
+func (p *TenantProvisioner) Provision(ctx context.Context, tenant string) error {
+	ctx, span := p.pg.trace(ctx, "TenantProvisioner.Provision", attribute.String("tenant", tenant))
+	defer span.End()
+
+	ctx = WithTenant(ctx, tenant)
+
+	schema := pgx.Identifier{p.pg.TenantSchema(tenant)}.Sanitize()
+	if _, err := p.pg.Exec(ctx, "create schema if not exists "+schema); err != nil {
+		desc := "failed to create tenant schema"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, desc)
+		return fmt.Errorf("%s %s: %w", desc, tenant, err)
+	}
+
+	if err := p.migrator.Up(ctx); err != nil {
+		desc := "failed to migrate tenant schema"
+		span.RecordError(err)
+		span.SetStatus(codes.Error, desc)
+		return fmt.Errorf("%s %s: %w", desc, tenant, err)
+	}
+	return nil
+}
+
+// Tenants returns ids of all provisioned tenants.
+func (p *TenantProvisioner) Tenants(ctx context.Context) ([]string, error) {
+	prefix := p.pg.TenantSchema("")
+
+	var schemas []string
+	err := pgxscan.Select(ctx, p.pg.pool, &schemas, `
+		select schema_name from information_schema.schemata
+		where starts_with(schema_name, $1)
+		order by schema_name`,
+		prefix,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list tenant schemas: %w", Classify(err))
+	}
+
+	tenants := make([]string, len(schemas))
+	for i, schema := range schemas {
+		tenants[i] = strings.TrimPrefix(schema, prefix)
+	}
+	return tenants, nil
+}
+
+// MigrateAll applies pending migrations to all provisioned tenants, stopping at the first failure.
+func (p *TenantProvisioner) MigrateAll(ctx context.Context) error {
+	tenants, err := p.Tenants(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, tenant := range tenants {
+		if err = p.Provision(ctx, tenant); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.34.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// TracingConfig is the configuration for spans and logs produced by pgx for every query.
+type TracingConfig struct {
+	// SlowQueryMs is a duration after which a query is logged as slow, slow queries aren't logged if zero.
+	SlowQueryMs int `yaml:"slow_query_ms"`
+	// RecordArgs adds query arguments to spans and slow query logs, they are redacted otherwise.
+	RecordArgs bool `yaml:"record_args"`
+}
+
+// redacted replaces query arguments when they aren't recorded.
+const redacted = "?"
+
+// queryTrace is stored in context between start and end of a traced operation.
+type queryTrace struct {
+	span  trace.Span
+	start time.Time
+	sql   string
+	args  []any
+}
+
+// queryTracer implements pgx.QueryTracer, pgx.BatchTracer, pgx.CopyFromTracer, pgx.ConnectTracer
+// and pgxpool.AcquireTracer producing OpenTelemetry spans by database semantic conventions.
+type queryTracer struct {
+	tracer     trace.Tracer
+	metrics    *Metrics
+	attrs      []attribute.KeyValue
+	slowQuery  time.Duration
+	recordArgs bool
+}
+
+// newQueryTracer creates a tracer for connections configured by connConfig.
+// Spans are not recorded when tracer is nil, but slow queries are still logged and metrics are collected.
+func newQueryTracer(
+	tracer trace.Tracer,
+	metrics *Metrics,
+	connConfig *pgx.ConnConfig,
+	cfg TracingConfig,
+) *queryTracer {
+	if tracer == nil {
+		tracer = noop.NewTracerProvider().Tracer("")
+	}
+
+	return &queryTracer{
+		tracer:  tracer,
+		metrics: metrics,
+		attrs: []attribute.KeyValue{
+			semconv.DBSystemNamePostgreSQL,
+			semconv.DBNamespace(connConfig.Database),
+			semconv.ServerAddress(connConfig.Host),
+			semconv.ServerPort(int(connConfig.Port)),
+		},
+		slowQuery:  time.Millisecond * time.Duration(cfg.SlowQueryMs),
+		recordArgs: cfg.RecordArgs,
+	}
+}
+
+func (t *queryTracer) start(
+	ctx context.Context,
+	op string,
+	sql string,
+	args []any,
+	attrs ...attribute.KeyValue,
+) context.Context {
+	attrs = append(attrs, t.attrs...)
+	if sql != "" {
+		attrs = append(attrs, semconv.DBQueryText(sql))
+	}
+	if t.recordArgs {
+		for i, arg := range args {
+			attrs = append(attrs, attribute.String("db.query.parameter."+strconv.Itoa(i), fmt.Sprint(arg)))
+		}
+	}
+
+	ctx, span := t.tracer.Start(ctx, op, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	return context.WithValue(ctx, queryTraceKey, &queryTrace{
+		span:  span,
+		start: time.Now(),
+		sql:   sql,
+		args:  args,
+	})
+}
+
+func (t *queryTracer) end(ctx context.Context, tag pgconn.CommandTag, err error) {
+	qt, ok := ctx.Value(queryTraceKey).(*queryTrace)
+	if !ok {
+		return
+	}
+	defer qt.span.End()
+
+	if err != nil {
+		recordError(qt.span, err)
+	}
+	if qt.sql == "" {
+		// connect and acquire aren't queries
+		return
+	}
+	if err == nil {
+		qt.span.SetAttributes(attribute.Int64("db.response.rows_affected", tag.RowsAffected()))
+	}
+
+	elapsed := time.Since(qt.start)
+	if t.metrics != nil {
+		t.metrics.observe(ctx, elapsed, err)
+	}
+	if t.slowQuery > 0 && elapsed >= t.slowQuery {
+		t.logSlowQuery(ctx, qt, elapsed)
+	}
+}
+
+func (t *queryTracer) logSlowQuery(ctx context.Context, qt *queryTrace, elapsed time.Duration) {
+	args := make([]string, len(qt.args))
+	for i, arg := range qt.args {
+		if t.recordArgs {
+			args[i] = fmt.Sprint(arg)
+		} else {
+			args[i] = redacted
+		}
+	}
+
+	log.Warn().
+		Str("trace_id", trace.SpanContextFromContext(ctx).TraceID().String()).
+		Str("query", qt.sql).
+		Str("query_name", QueryName(ctx)).
+		Strs("args", args).
+		Dur("duration", elapsed).
+		Msg("slow query")
+}
+
+// recordError sets error status for span, adding SQLSTATE for server errors.
+func recordError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		span.SetAttributes(semconv.DBResponseStatusCode(pgErr.Code), semconv.ErrorTypeKey.String(pgErr.Code))
+	} else {
+		span.SetAttributes(semconv.ErrorTypeOther)
+	}
+}
+
+// operationName returns the first keyword of sql to be used as a span name.
+func operationName(sql string) string {
+	if fields := strings.Fields(sql); len(fields) > 0 {
+		return strings.ToUpper(fields[0])
+	}
+	return semconv.DBSystemNamePostgreSQL.Value.AsString()
+}
+
+// TraceQueryStart implements pgx.QueryTracer.
+func (t *queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	op := operationName(data.SQL)
+	return t.start(ctx, op, data.SQL, data.Args, semconv.DBOperationName(op))
+}
+
+// TraceQueryEnd implements pgx.QueryTracer.
+func (t *queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	t.end(ctx, data.CommandTag, data.Err)
+}
+
+// TraceBatchStart implements pgx.BatchTracer.
+func (t *queryTracer) TraceBatchStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchStartData) context.Context {
+	return t.start(
+		ctx,
+		"BATCH",
+		"",
+		nil,
+		semconv.DBOperationName("BATCH"),
+		semconv.DBOperationBatchSize(data.Batch.Len()),
+	)
+}
+
+// TraceBatchQuery implements pgx.BatchTracer.
+func (t *queryTracer) TraceBatchQuery(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchQueryData) {
+	qt, ok := ctx.Value(queryTraceKey).(*queryTrace)
+	if !ok {
+		return
+	}
+
+	attrs := []attribute.KeyValue{
+		semconv.DBQueryText(data.SQL),
+		attribute.Int64("db.response.rows_affected", data.CommandTag.RowsAffected()),
+	}
+	if data.Err != nil {
+		attrs = append(attrs, semconv.ErrorMessage(data.Err.Error()))
+	}
+	qt.span.AddEvent("query", trace.WithAttributes(attrs...))
+
+	if qt.sql != "" {
+		qt.sql += "; "
+	}
+	qt.sql += data.SQL
+	qt.args = append(qt.args, data.Args...)
+}
+
+// TraceBatchEnd implements pgx.BatchTracer.
+func (t *queryTracer) TraceBatchEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceBatchEndData) {
+	if qt, ok := ctx.Value(queryTraceKey).(*queryTrace); ok && qt.sql != "" {
+		qt.span.SetAttributes(semconv.DBQueryText(qt.sql))
+	}
+	t.end(ctx, pgconn.CommandTag{}, data.Err)
+}
+
+// TraceCopyFromStart implements pgx.CopyFromTracer.
+func (t *queryTracer) TraceCopyFromStart(
+	ctx context.Context,
+	_ *pgx.Conn,
+	data pgx.TraceCopyFromStartData,
+) context.Context {
+	table := data.TableName.Sanitize()
+	return t.start(
+		ctx,
+		"COPY",
+		"copy "+table+" ("+strings.Join(data.ColumnNames, ", ")+") from stdin",
+		nil,
+		semconv.DBOperationName("COPY"),
+		semconv.DBCollectionName(table),
+	)
+}
+
+// TraceCopyFromEnd implements pgx.CopyFromTracer.
+func (t *queryTracer) TraceCopyFromEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceCopyFromEndData) {
+	t.end(ctx, data.CommandTag, data.Err)
+}
+
+// TraceConnectStart implements pgx.ConnectTracer.
+func (t *queryTracer) TraceConnectStart(ctx context.Context, _ pgx.TraceConnectStartData) context.Context {
+	return t.start(ctx, "CONNECT", "", nil)
+}
+
+// TraceConnectEnd implements pgx.ConnectTracer.
+func (t *queryTracer) TraceConnectEnd(ctx context.Context, data pgx.TraceConnectEndData) {
+	t.end(ctx, pgconn.CommandTag{}, data.Err)
+}
+
+// TraceAcquireStart implements pgxpool.AcquireTracer.
+func (t *queryTracer) TraceAcquireStart(
+	ctx context.Context,
+	_ *pgxpool.Pool,
+	_ pgxpool.TraceAcquireStartData,
+) context.Context {
+	return t.start(ctx, "ACQUIRE", "", nil)
+}
+
+// TraceAcquireEnd implements pgxpool.AcquireTracer.
+func (t *queryTracer) TraceAcquireEnd(ctx context.Context, _ *pgxpool.Pool, data pgxpool.TraceAcquireEndData) {
+	t.end(ctx, pgconn.CommandTag{}, data.Err)
+}
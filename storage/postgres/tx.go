@@ -0,0 +1,118 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/yogenyslav/pkg/storage"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+)
+
+const (
+	defaultBackoffBase = 10 * time.Millisecond
+	defaultBackoffMax  = time.Second
+)
+
+// ExponentialBackoff returns a backoff function for storage.TxOptions
+// that doubles the delay on every attempt up to maxDelay and applies full jitter.
+func ExponentialBackoff(base, maxDelay time.Duration) func(attempt int) time.Duration {
+	return func(attempt int) time.Duration {
+		delay := base
+		for i := 1; i < attempt && delay < maxDelay; i++ {
+			delay *= 2
+		}
+		delay = min(delay, maxDelay)
+		if delay <= 0 {
+			return 0
+		}
+		return rand.N(delay) + 1 //nolint:gosec // jitter doesn't need crypto rand
+	}
+}
+
+// WithTx runs fn in a transaction, committing it if fn succeeds and rolling it back if fn returns an error or panics.
+// The transaction is retried up to opts.MaxRetries times when postgres reports a serialization failure or a deadlock.
+//
+// If ctx already holds a transaction, fn runs in a savepoint and is never retried,
+// because a serialization failure aborts the whole outer transaction.
+func (pg Postgres) WithTx(ctx context.Context, opts storage.TxOptions, fn func(ctx context.Context) error) error {
+	if _, err := pg.GetTx(ctx); err == nil {
+		opts.MaxRetries = 0
+	}
+
+	ctx, span := pg.trace(ctx, "Postgres.WithTx", attribute.Int("max_retries", opts.MaxRetries))
+	defer span.End()
+
+	backoff := opts.Backoff
+	if backoff == nil {
+		backoff = ExponentialBackoff(defaultBackoffBase, defaultBackoffMax)
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := pg.runTx(ctx, opts, attempt, fn)
+		if err == nil {
+			return nil
+		}
+		if attempt >= opts.MaxRetries || !isRetryable(err) {
+			desc := "transaction failed"
+			span.RecordError(err)
+			span.SetStatus(codes.Error, desc)
+			return fmt.Errorf("%s after %d attempts: %w", desc, attempt+1, Classify(err))
+		}
+
+		timer := time.NewTimer(backoff(attempt + 1))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("wait for transaction retry: %w", errors.Join(ctx.Err(), err))
+		case <-timer.C:
+		}
+	}
+}
+
+// runTx makes a single attempt to run fn in a transaction.
+func (pg Postgres) runTx(
+	ctx context.Context,
+	opts storage.TxOptions,
+	attempt int,
+	fn func(ctx context.Context) error,
+) (err error) {
+	ctx, span := pg.trace(ctx, "Postgres.WithTx.Attempt", attribute.Int("attempt", attempt+1))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "transaction attempt failed")
+		}
+		span.End()
+	}()
+
+	txCtx, err := pg.Begin(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = pg.RollbackTx(txCtx)
+			panic(p)
+		}
+	}()
+
+	if err = fn(txCtx); err != nil {
+		if rbErr := pg.RollbackTx(txCtx); rbErr != nil {
+			return errors.Join(err, rbErr)
+		}
+		return err
+	}
+
+	return pg.CommitTx(txCtx)
+}
+
+// isRetryable reports whether err is a serialization failure or a deadlock that can be resolved by a retry.
+func isRetryable(err error) bool {
+	err = Classify(err)
+	return errors.Is(err, ErrSerializationFailure) || errors.Is(err, ErrDeadlock)
+}
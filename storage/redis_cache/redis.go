@@ -10,12 +10,15 @@ import (
 	"time"
 
 	"github.com/redis/go-redis/v9"
+	"github.com/yogenyslav/pkg/storage"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 )
 
 // ErrNotFound reports that key doesn't exist.
-var ErrNotFound = errors.New("key not found")
+//
+// Deprecated: use storage.ErrNotFound, ErrNotFound is the same error.
+var ErrNotFound = storage.ErrNotFound
 
 // Redis wraps go-redis client and adds tracer to all operations.
 type Redis struct {
@@ -123,7 +126,10 @@ func (r Redis) GetString(ctx context.Context, k string) (string, error) {
 	if errors.Is(err, redis.Nil) {
 		return "", ErrNotFound
 	}
-	return res, fmt.Errorf("failed to get string: %w", err)
+	if err != nil {
+		return res, fmt.Errorf("failed to get string: %w", err)
+	}
+	return res, nil
 }
 
 // GetInt gets an integer from the cache with the given key.
@@ -142,7 +148,10 @@ func (r Redis) GetInt(ctx context.Context, k string) (int, error) {
 	if errors.Is(err, redis.Nil) {
 		return 0, ErrNotFound
 	}
-	return res, fmt.Errorf("failed to get int: %w", err)
+	if err != nil {
+		return res, fmt.Errorf("failed to get int: %w", err)
+	}
+	return res, nil
 }
 
 // GetInt64 gets an int64 from the cache with the given key.
@@ -161,7 +170,10 @@ func (r Redis) GetInt64(ctx context.Context, k string) (int64, error) {
 	if errors.Is(err, redis.Nil) {
 		return 0, ErrNotFound
 	}
-	return res, fmt.Errorf("failed to get int64: %w", err)
+	if err != nil {
+		return res, fmt.Errorf("failed to get int64: %w", err)
+	}
+	return res, nil
 }
 
 // GetFloat gets a float64 from the cache with the given key.
@@ -180,7 +192,10 @@ func (r Redis) GetFloat(ctx context.Context, k string) (float64, error) {
 	if errors.Is(err, redis.Nil) {
 		return 0, ErrNotFound
 	}
-	return res, fmt.Errorf("failed to get float64: %w", err)
+	if err != nil {
+		return res, fmt.Errorf("failed to get float64: %w", err)
+	}
+	return res, nil
 }
 
 // GetBool gets a bool from the cache with the given key.
@@ -199,7 +214,10 @@ func (r Redis) GetBool(ctx context.Context, k string) (bool, error) {
 	if errors.Is(err, redis.Nil) {
 		return false, ErrNotFound
 	}
-	return res, fmt.Errorf("failed to get bool: %w", err)
+	if err != nil {
+		return res, fmt.Errorf("failed to get bool: %w", err)
+	}
+	return res, nil
 }
 
 // GetBytes gets a byte slice from the cache with the given key.
@@ -218,7 +236,10 @@ func (r Redis) GetBytes(ctx context.Context, k string) ([]byte, error) {
 	if errors.Is(err, redis.Nil) {
 		return nil, ErrNotFound
 	}
-	return res, fmt.Errorf("failed to get bytes: %w", err)
+	if err != nil {
+		return res, fmt.Errorf("failed to get bytes: %w", err)
+	}
+	return res, nil
 }
 
 // Del deletes a key from the cache.
@@ -3,6 +3,7 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/jackc/pgx/v5"
@@ -10,16 +11,51 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ErrNotFound is an error when a key doesn't exist in Cache.
+var ErrNotFound = errors.New("key not found")
+
+// TxOptions configures a transaction started by SQLDatabase.Begin or SQLDatabase.WithTx.
+// Options are ignored for nested transactions, which are implemented with savepoints.
+type TxOptions struct {
+	// IsoLevel is the isolation level of the transaction, database default if empty.
+	IsoLevel pgx.TxIsoLevel
+	// AccessMode is the access mode of the transaction, read write if empty.
+	AccessMode pgx.TxAccessMode
+	// DeferrableMode makes a serializable read only transaction deferrable.
+	DeferrableMode pgx.TxDeferrableMode
+	// MaxRetries is the number of extra attempts made after a serialization failure or a deadlock.
+	MaxRetries int
+	// Backoff returns the delay before the given retry attempt, starting from 1.
+	Backoff func(attempt int) time.Duration
+}
+
+// Rows is a result set read row by row, see SQLDatabase.QueryRows.
+type Rows interface {
+	// Next prepares the next row for Scan, returns false if there are no more rows or an error occurred.
+	Next() bool
+	// Scan scans the current row into dest the same way Query does.
+	Scan(dest any) error
+	// Err returns the error occurred while reading rows, if any.
+	Err() error
+	// Close closes the rows, it's safe to call it multiple times.
+	Close()
+}
+
 // SQLDatabase is an interface that wraps the basic SQL operations.
 type SQLDatabase interface {
+	// Begin starts a new transaction with the given options or a savepoint if ctx already holds a transaction.
+	Begin(ctx context.Context, opts TxOptions) (context.Context, error)
 	// BeginSerializable starts a new transaction with serializable isolation level.
 	BeginSerializable(ctx context.Context) (context.Context, error)
 	// GetTx returns a transaction from ctx or an error if there is no tx.
 	GetTx(ctx context.Context) (pgx.Tx, error)
-	// CommitTx commits the transaction.
+	// CommitTx commits the transaction or releases the savepoint.
 	CommitTx(ctx context.Context) error
-	// RollbackTx rolls back the transaction.
+	// RollbackTx rolls back the transaction or rolls back to the savepoint.
 	RollbackTx(ctx context.Context) error
+	// WithTx runs fn in a transaction, committing it if fn succeeds and rolling it back otherwise.
+	// Serialization failures and deadlocks are retried according to opts.
+	WithTx(ctx context.Context, opts TxOptions, fn func(ctx context.Context) error) error
 	// Query executes a query that returns a single row.
 	Query(ctx context.Context, dest any, query string, args ...any) error
 	// QuerySlice executes a query that returns multiple rows.
@@ -34,6 +70,9 @@ type SQLDatabase interface {
 	// ExecTx executes a query that doesn't return any rows in a transaction.
 	// Returns number of affected rows.
 	ExecTx(ctx context.Context, query string, args ...any) (int64, error)
+	// QueryRows executes a query that returns multiple rows to be scanned one by one,
+	// in the transaction from ctx if there is one. Rows must be closed.
+	QueryRows(ctx context.Context, query string, args ...any) (Rows, error)
 	// Close closes the database connection.
 	Close()
 }
@@ -74,11 +113,99 @@ type MongoDatabase interface {
 		filter interface{},
 		opts ...*options.DeleteOptions,
 	) (*mongo.DeleteResult, error)
+	// InsertMany inserts multiple documents into the collection.
+	InsertMany(
+		ctx context.Context,
+		coll string,
+		docs []interface{},
+		opts ...*options.InsertManyOptions,
+	) (*mongo.InsertManyResult, error)
+	// DeleteMany deletes multiple documents from the collection.
+	DeleteMany(
+		ctx context.Context,
+		coll string,
+		filter interface{},
+		opts ...*options.DeleteOptions,
+	) (*mongo.DeleteResult, error)
+	// ReplaceOne replaces a single document in the collection.
+	ReplaceOne(
+		ctx context.Context,
+		coll string,
+		filter interface{},
+		replacement interface{},
+		opts ...*options.ReplaceOptions,
+	) (*mongo.UpdateResult, error)
+	// UpsertOne updates a single document in the collection or inserts it if none matches filter.
+	UpsertOne(
+		ctx context.Context,
+		coll string,
+		filter interface{},
+		update interface{},
+		opts ...*options.UpdateOptions,
+	) (*mongo.UpdateResult, error)
+	// UpsertReplaceOne replaces a single document in the collection or inserts it if none matches filter.
+	UpsertReplaceOne(
+		ctx context.Context,
+		coll string,
+		filter interface{},
+		replacement interface{},
+		opts ...*options.ReplaceOptions,
+	) (*mongo.UpdateResult, error)
+	// BulkWrite executes multiple write operations in the collection.
+	BulkWrite(
+		ctx context.Context,
+		coll string,
+		models []mongo.WriteModel,
+		opts ...*options.BulkWriteOptions,
+	) (*mongo.BulkWriteResult, error)
+	// Aggregate runs an aggregation pipeline on the collection and decodes all results into dest.
+	Aggregate(ctx context.Context, coll string, pipeline, dest interface{}, opts ...*options.AggregateOptions) error
+	// CountDocuments counts documents matching filter in the collection.
+	CountDocuments(ctx context.Context, coll string, filter interface{}, opts ...*options.CountOptions) (int64, error)
+	// EstimatedDocumentCount returns an estimate of the number of documents in the collection.
+	EstimatedDocumentCount(
+		ctx context.Context,
+		coll string,
+		opts ...*options.EstimatedDocumentCountOptions,
+	) (int64, error)
+	// Distinct finds distinct values of the field among documents matching filter in the collection.
+	Distinct(
+		ctx context.Context,
+		coll string,
+		field string,
+		filter interface{},
+		opts ...*options.DistinctOptions,
+	) ([]interface{}, error)
+	// FindOneAndUpdate updates a single document in the collection and decodes it into dest.
+	FindOneAndUpdate(
+		ctx context.Context,
+		coll string,
+		filter, update, dest interface{},
+		opts ...*options.FindOneAndUpdateOptions,
+	) error
+	// FindOneAndReplace replaces a single document in the collection and decodes it into dest.
+	FindOneAndReplace(
+		ctx context.Context,
+		coll string,
+		filter, replacement, dest interface{},
+		opts ...*options.FindOneAndReplaceOptions,
+	) error
+	// FindOneAndDelete deletes a single document from the collection and decodes it into dest.
+	FindOneAndDelete(
+		ctx context.Context,
+		coll string,
+		filter, dest interface{},
+		opts ...*options.FindOneAndDeleteOptions,
+	) error
+	// WithTransaction runs fn in a multi-document transaction, committing it if fn succeeds and aborting it otherwise.
+	// Operations made with the context passed to fn participate in the transaction.
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error, opts ...*options.TransactionOptions) error
 	// Close closes the MongoDB client.
 	Close() error
 }
 
 // Cache is an interface that wraps the basic cache operations.
+// Get methods return ErrNotFound if the key doesn't exist.
 type Cache interface {
 	// SetStruct sets a struct in the cache.
 	SetStruct(ctx context.Context, k string, v any, exp time.Duration) error
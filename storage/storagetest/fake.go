@@ -0,0 +1,639 @@
+// Package storagetest provides fakes and contract test suites for storage interfaces.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/yogenyslav/pkg/storage"
+	"github.com/yogenyslav/pkg/storage/postgres"
+)
+
+var (
+	// ErrUnexpectedQuery is an error when FakeSQL receives a query without a matching expectation.
+	ErrUnexpectedQuery = errors.New("unexpected query")
+	// ErrUnmetExpectations is an error when some expectations of FakeSQL weren't called.
+	ErrUnmetExpectations = errors.New("unmet expectations")
+	// ErrResultType is an error when an expected result can't be assigned to the query destination.
+	ErrResultType = errors.New("result is not assignable to destination")
+	// ErrNotSupported is an error when a pgx.Tx method isn't supported by the fake transaction.
+	ErrNotSupported = errors.New("not supported by fake transaction")
+)
+
+const (
+	kindQuery = "query"
+	kindExec  = "exec"
+)
+
+// Call is a call recorded by FakeSQL.
+type Call struct {
+	// Method is the name of the called SQLDatabase method.
+	Method string
+	// Query is the query passed to the method, empty for transaction methods.
+	Query string
+	Args  []any
+	// InTx is true if the call was made in a transaction.
+	InTx bool
+}
+
+// Expectation describes the result of queries matching it, see FakeSQL.ExpectQuery and FakeSQL.ExpectExec.
+type Expectation struct {
+	kind    string
+	query   string
+	args    []any
+	hasArgs bool
+	result  any
+	rows    int64
+	err     error
+	times   int
+	calls   int
+}
+
+// WithArgs makes the expectation match only queries with the given args.
+func (e *Expectation) WithArgs(args ...any) *Expectation {
+	e.args = args
+	e.hasArgs = true
+	return e
+}
+
+// WillReturn sets the value stored into dest of a matching query, a slice for QuerySlice and QueryRows.
+// Query without a result returns pgx.ErrNoRows.
+func (e *Expectation) WillReturn(v any) *Expectation {
+	e.result = v
+	return e
+}
+
+// WillReturnRowsAffected sets the number of rows affected by a matching exec.
+func (e *Expectation) WillReturnRowsAffected(n int64) *Expectation {
+	e.rows = n
+	return e
+}
+
+// WillReturnError makes a matching query fail with err.
+func (e *Expectation) WillReturnError(err error) *Expectation {
+	e.err = err
+	return e
+}
+
+// Times sets how many queries the expectation matches, once by default and any number of times if n is negative.
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+func (e *Expectation) matches(kind, query string, args []any) bool {
+	if e.kind != kind || e.query != normalizeQuery(query) {
+		return false
+	}
+	if e.times >= 0 && e.calls >= e.times {
+		return false
+	}
+	return !e.hasArgs || reflect.DeepEqual(e.args, args)
+}
+
+// normalizeQuery collapses whitespace, so expectations don't depend on query formatting.
+func normalizeQuery(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
+
+// FakeSQL is an in-memory storage.SQLDatabase returning results set by expectations and recording every call.
+// Transactions are stored in context like Postgres does, so GetTx, CommitTx and RollbackTx behave the same way.
+// The zero value is ready to use.
+type FakeSQL struct {
+	mu           sync.Mutex
+	expectations []*Expectation
+	calls        []Call
+}
+
+var _ storage.SQLDatabase = (*FakeSQL)(nil)
+
+// NewFakeSQL creates a new FakeSQL.
+func NewFakeSQL() *FakeSQL {
+	return &FakeSQL{}
+}
+
+// ExpectQuery adds an expectation for Query, QuerySlice, QueryTx and QuerySliceTx calls with query.
+// Queries are compared ignoring whitespace differences, a call matches the first expectation that isn't used up.
+func (f *FakeSQL) ExpectQuery(query string) *Expectation {
+	return f.expect(kindQuery, query)
+}
+
+// ExpectExec adds an expectation for Exec and ExecTx calls with query.
+// Queries are compared ignoring whitespace differences.
+func (f *FakeSQL) ExpectExec(query string) *Expectation {
+	return f.expect(kindExec, query)
+}
+
+func (f *FakeSQL) expect(kind, query string) *Expectation {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	e := &Expectation{kind: kind, query: normalizeQuery(query), times: 1}
+	f.expectations = append(f.expectations, e)
+	return e
+}
+
+// ExpectationsWereMet returns an error listing expectations that matched fewer queries than expected.
+func (f *FakeSQL) ExpectationsWereMet() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var unmet []string
+	for _, e := range f.expectations {
+		if e.times >= 0 && e.calls < e.times {
+			unmet = append(unmet, fmt.Sprintf("%s %q called %d of %d times", e.kind, e.query, e.calls, e.times))
+		}
+	}
+	if len(unmet) > 0 {
+		return fmt.Errorf("%w: %s", ErrUnmetExpectations, strings.Join(unmet, "; "))
+	}
+	return nil
+}
+
+// Calls returns all recorded calls in order.
+func (f *FakeSQL) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	calls := make([]Call, len(f.calls))
+	copy(calls, f.calls)
+	return calls
+}
+
+// Reset removes all expectations and recorded calls.
+func (f *FakeSQL) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.expectations = nil
+	f.calls = nil
+}
+
+func (f *FakeSQL) record(method, query string, args []any, inTx bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls = append(f.calls, Call{Method: method, Query: query, Args: args, InTx: inTx})
+}
+
+// match finds the first expectation for the query and marks it called.
+func (f *FakeSQL) match(kind, query string, args []any) (*Expectation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, e := range f.expectations {
+		if e.matches(kind, query, args) {
+			e.calls++
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s %q with args %v", ErrUnexpectedQuery, kind, normalizeQuery(query), args)
+}
+
+// tx returns the fake transaction from ctx.
+func (f *FakeSQL) tx(ctx context.Context) (*fakeTx, error) {
+	tx, ok := ctx.Value(postgres.TxKey).(*fakeTx)
+	if !ok {
+		return nil, fmt.Errorf("get transaction: %w", postgres.ErrNoTxFound)
+	}
+	return tx, nil
+}
+
+// Begin implements storage.SQLDatabase.
+func (f *FakeSQL) Begin(ctx context.Context, _ storage.TxOptions) (context.Context, error) {
+	f.record("Begin", "", nil, ctx.Value(postgres.TxKey) != nil)
+
+	tx := &fakeTx{db: f}
+	if parent, ok := ctx.Value(postgres.TxKey).(*fakeTx); ok {
+		if parent.isClosed() {
+			return ctx, fmt.Errorf("create savepoint: %w", pgx.ErrTxClosed)
+		}
+		tx.parent = parent
+	}
+	return context.WithValue(ctx, postgres.TxKey, tx), nil
+}
+
+// BeginSerializable implements storage.SQLDatabase.
+func (f *FakeSQL) BeginSerializable(ctx context.Context) (context.Context, error) {
+	return f.Begin(ctx, storage.TxOptions{IsoLevel: pgx.Serializable, AccessMode: pgx.ReadWrite})
+}
+
+// GetTx implements storage.SQLDatabase.
+func (f *FakeSQL) GetTx(ctx context.Context) (pgx.Tx, error) {
+	return f.tx(ctx)
+}
+
+// CommitTx implements storage.SQLDatabase.
+func (f *FakeSQL) CommitTx(ctx context.Context) error {
+	f.record("CommitTx", "", nil, true)
+
+	tx, err := f.tx(ctx)
+	if err != nil {
+		return fmt.Errorf("get transaction: %w", err)
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// RollbackTx implements storage.SQLDatabase.
+func (f *FakeSQL) RollbackTx(ctx context.Context) error {
+	f.record("RollbackTx", "", nil, true)
+
+	tx, err := f.tx(ctx)
+	if err != nil {
+		return fmt.Errorf("get transaction: %w", err)
+	}
+	if err = tx.Rollback(ctx); err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+		return fmt.Errorf("failed to rollback transaction: %w", err)
+	}
+	return nil
+}
+
+// WithTx implements storage.SQLDatabase.
+// Retries are made without waiting for opts.Backoff.
+func (f *FakeSQL) WithTx(ctx context.Context, opts storage.TxOptions, fn func(ctx context.Context) error) error {
+	if _, err := f.tx(ctx); err == nil {
+		opts.MaxRetries = 0
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := f.runTx(ctx, opts, fn)
+		if err == nil {
+			return nil
+		}
+
+		retryable := errors.Is(err, postgres.ErrSerializationFailure) || errors.Is(err, postgres.ErrDeadlock)
+		if attempt >= opts.MaxRetries || !retryable {
+			return fmt.Errorf("transaction failed after %d attempts: %w", attempt+1, err)
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("wait for transaction retry: %w", errors.Join(ctx.Err(), err))
+		}
+	}
+}
+
+func (f *FakeSQL) runTx(ctx context.Context, opts storage.TxOptions, fn func(ctx context.Context) error) error {
+	txCtx, err := f.Begin(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = f.RollbackTx(txCtx)
+			panic(p)
+		}
+	}()
+
+	if err = fn(txCtx); err != nil {
+		if rbErr := f.RollbackTx(txCtx); rbErr != nil {
+			return errors.Join(err, rbErr)
+		}
+		return err
+	}
+
+	return f.CommitTx(txCtx)
+}
+
+// Query implements storage.SQLDatabase.
+func (f *FakeSQL) Query(_ context.Context, dest any, query string, args ...any) error {
+	f.record("Query", query, args, false)
+
+	if err := f.query(dest, query, args); err != nil {
+		return fmt.Errorf("failed to get row: %w", err)
+	}
+	return nil
+}
+
+// QuerySlice implements storage.SQLDatabase.
+func (f *FakeSQL) QuerySlice(_ context.Context, dest any, query string, args ...any) error {
+	f.record("QuerySlice", query, args, false)
+
+	if err := f.querySlice(dest, query, args); err != nil {
+		return fmt.Errorf("failed to get rows: %w", err)
+	}
+	return nil
+}
+
+// Exec implements storage.SQLDatabase.
+func (f *FakeSQL) Exec(_ context.Context, query string, args ...any) (int64, error) {
+	f.record("Exec", query, args, false)
+
+	rows, err := f.exec(query, args)
+	if err != nil {
+		return 0, fmt.Errorf("failed to exec: %w", err)
+	}
+	return rows, nil
+}
+
+// QueryTx implements storage.SQLDatabase.
+func (f *FakeSQL) QueryTx(ctx context.Context, dest any, query string, args ...any) error {
+	f.record("QueryTx", query, args, true)
+
+	tx, err := f.tx(ctx)
+	if err != nil {
+		return fmt.Errorf("get transaction: %w", err)
+	}
+	if tx.isClosed() {
+		return fmt.Errorf("failed to get row in transaction: %w", pgx.ErrTxClosed)
+	}
+
+	if err = f.query(dest, query, args); err != nil {
+		return fmt.Errorf("failed to get row in transaction: %w", err)
+	}
+	return nil
+}
+
+// QuerySliceTx implements storage.SQLDatabase.
+func (f *FakeSQL) QuerySliceTx(ctx context.Context, dest any, query string, args ...any) error {
+	f.record("QuerySliceTx", query, args, true)
+
+	tx, err := f.tx(ctx)
+	if err != nil {
+		return fmt.Errorf("get transaction: %w", err)
+	}
+	if tx.isClosed() {
+		return fmt.Errorf("failed to get rows in transaction: %w", pgx.ErrTxClosed)
+	}
+
+	if err = f.querySlice(dest, query, args); err != nil {
+		return fmt.Errorf("failed to get rows in transaction: %w", err)
+	}
+	return nil
+}
+
+// ExecTx implements storage.SQLDatabase.
+func (f *FakeSQL) ExecTx(ctx context.Context, query string, args ...any) (int64, error) {
+	f.record("ExecTx", query, args, true)
+
+	tx, err := f.tx(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("get transaction: %w", err)
+	}
+
+	tag, err := tx.Exec(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to exec in transaction: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// QueryRows implements storage.SQLDatabase, rows are elements of the expected slice.
+func (f *FakeSQL) QueryRows(ctx context.Context, query string, args ...any) (storage.Rows, error) {
+	tx, err := f.tx(ctx)
+	inTx := err == nil
+	f.record("QueryRows", query, args, inTx)
+
+	if inTx && tx.isClosed() {
+		return nil, fmt.Errorf("failed to get rows in transaction: %w", pgx.ErrTxClosed)
+	}
+
+	e, err := f.match(kindQuery, query, args)
+	if err == nil {
+		err = e.err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rows: %w", err)
+	}
+
+	rows := &fakeRows{index: -1}
+	if e.result != nil {
+		rows.values = reflect.ValueOf(e.result)
+		if rows.values.Kind() != reflect.Slice {
+			return nil, fmt.Errorf("failed to get rows: %w: %T is not a slice", ErrResultType, e.result)
+		}
+	}
+	return rows, nil
+}
+
+// Close implements storage.SQLDatabase.
+func (f *FakeSQL) Close() {
+	f.record("Close", "", nil, false)
+}
+
+func (f *FakeSQL) query(dest any, query string, args []any) error {
+	e, err := f.match(kindQuery, query, args)
+	if err != nil {
+		return err
+	}
+	if e.err != nil {
+		return e.err
+	}
+	if e.result == nil {
+		return pgx.ErrNoRows
+	}
+	return assign(dest, e.result)
+}
+
+func (f *FakeSQL) querySlice(dest any, query string, args []any) error {
+	e, err := f.match(kindQuery, query, args)
+	if err != nil {
+		return err
+	}
+	if e.err != nil {
+		return e.err
+	}
+	if d := reflect.ValueOf(dest); e.result == nil && d.Kind() == reflect.Pointer && d.Elem().Kind() == reflect.Slice {
+		// no rows, scany leaves an empty slice
+		d.Elem().Set(reflect.MakeSlice(d.Elem().Type(), 0, 0))
+		return nil
+	}
+	return assign(dest, e.result)
+}
+
+func (f *FakeSQL) exec(query string, args []any) (int64, error) {
+	e, err := f.match(kindExec, query, args)
+	if err != nil {
+		return 0, err
+	}
+	if e.err != nil {
+		return 0, e.err
+	}
+	return e.rows, nil
+}
+
+// assign stores v or the value v points to into the pointer dest.
+func assign(dest, v any) error {
+	d := reflect.ValueOf(dest)
+	if d.Kind() != reflect.Pointer || d.IsNil() {
+		return fmt.Errorf("%w: destination must be a non-nil pointer, got %T", ErrResultType, dest)
+	}
+
+	val := reflect.ValueOf(v)
+	if !val.Type().AssignableTo(d.Elem().Type()) && val.Kind() == reflect.Pointer {
+		val = val.Elem()
+	}
+	if !val.Type().AssignableTo(d.Elem().Type()) {
+		return fmt.Errorf("%w: %T to %T", ErrResultType, v, dest)
+	}
+
+	d.Elem().Set(val)
+	return nil
+}
+
+// fakeRows implements storage.Rows over elements of an expected slice.
+type fakeRows struct {
+	values reflect.Value
+	index  int
+	closed bool
+}
+
+func (r *fakeRows) Next() bool {
+	if r.closed || !r.values.IsValid() || r.index+1 >= r.values.Len() {
+		r.closed = true
+		return false
+	}
+	r.index++
+	return true
+}
+
+func (r *fakeRows) Scan(dest any) error {
+	if r.closed || r.index < 0 {
+		return fmt.Errorf("%w: no current row", ErrResultType)
+	}
+	return assign(dest, r.values.Index(r.index).Interface())
+}
+
+func (r *fakeRows) Err() error {
+	return nil
+}
+
+func (r *fakeRows) Close() {
+	r.closed = true
+}
+
+// fakeTx is a pgx.Tx tracking its state, queries made through it are matched against FakeSQL expectations.
+type fakeTx struct {
+	db     *FakeSQL
+	parent *fakeTx
+	mu     sync.Mutex
+	closed bool
+}
+
+var _ pgx.Tx = (*fakeTx)(nil)
+
+func (tx *fakeTx) isClosed() bool {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	return tx.closed || (tx.parent != nil && tx.parent.isClosed())
+}
+
+// close marks tx closed, returns pgx.ErrTxClosed if it already was.
+func (tx *fakeTx) close() error {
+	if tx.parent != nil && tx.parent.isClosed() {
+		return pgx.ErrTxClosed
+	}
+
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	if tx.closed {
+		return pgx.ErrTxClosed
+	}
+	tx.closed = true
+	return nil
+}
+
+// Begin implements pgx.Tx.
+func (tx *fakeTx) Begin(context.Context) (pgx.Tx, error) {
+	if tx.isClosed() {
+		return nil, pgx.ErrTxClosed
+	}
+
+	return &fakeTx{db: tx.db, parent: tx}, nil
+}
+
+// Commit implements pgx.Tx.
+func (tx *fakeTx) Commit(context.Context) error {
+	return tx.close()
+}
+
+// Rollback implements pgx.Tx.
+func (tx *fakeTx) Rollback(context.Context) error {
+	return tx.close()
+}
+
+// Exec implements pgx.Tx.
+func (tx *fakeTx) Exec(_ context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	if tx.isClosed() {
+		return pgconn.CommandTag{}, pgx.ErrTxClosed
+	}
+
+	rows, err := tx.db.exec(sql, args)
+	if err != nil {
+		return pgconn.CommandTag{}, err
+	}
+	return pgconn.NewCommandTag(fmt.Sprintf("UPDATE %d", rows)), nil
+}
+
+// CopyFrom implements pgx.Tx, it isn't supported.
+func (tx *fakeTx) CopyFrom(context.Context, pgx.Identifier, []string, pgx.CopyFromSource) (int64, error) {
+	return 0, ErrNotSupported
+}
+
+// SendBatch implements pgx.Tx, it isn't supported.
+func (tx *fakeTx) SendBatch(context.Context, *pgx.Batch) pgx.BatchResults {
+	return errBatchResults{err: ErrNotSupported}
+}
+
+// LargeObjects implements pgx.Tx, it isn't supported.
+func (tx *fakeTx) LargeObjects() pgx.LargeObjects {
+	return pgx.LargeObjects{}
+}
+
+// Prepare implements pgx.Tx, it isn't supported.
+func (tx *fakeTx) Prepare(context.Context, string, string) (*pgconn.StatementDescription, error) {
+	return nil, ErrNotSupported
+}
+
+// Query implements pgx.Tx, it isn't supported, use FakeSQL.QueryTx.
+func (tx *fakeTx) Query(context.Context, string, ...any) (pgx.Rows, error) {
+	return nil, ErrNotSupported
+}
+
+// QueryRow implements pgx.Tx, it isn't supported, use FakeSQL.QueryTx.
+func (tx *fakeTx) QueryRow(context.Context, string, ...any) pgx.Row {
+	return errRow{err: ErrNotSupported}
+}
+
+// Conn implements pgx.Tx, there is no connection.
+func (tx *fakeTx) Conn() *pgx.Conn {
+	return nil
+}
+
+type errRow struct {
+	err error
+}
+
+func (r errRow) Scan(...any) error {
+	return r.err
+}
+
+type errBatchResults struct {
+	err error
+}
+
+func (r errBatchResults) Exec() (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, r.err
+}
+
+func (r errBatchResults) Query() (pgx.Rows, error) {
+	return nil, r.err
+}
+
+func (r errBatchResults) QueryRow() pgx.Row {
+	return errRow(r)
+}
+
+func (r errBatchResults) Close() error {
+	return r.err
+}
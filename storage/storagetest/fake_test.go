@@ -0,0 +1,19 @@
+package storagetest
+
+import (
+	"testing"
+
+	"github.com/yogenyslav/pkg/storage"
+)
+
+func TestFakeSQLContract(t *testing.T) {
+	RunSQLDatabase(t, func(t *testing.T) storage.SQLDatabase {
+		db := NewFakeSQL()
+		t.Cleanup(func() {
+			if err := db.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+		return db
+	})
+}
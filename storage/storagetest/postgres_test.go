@@ -0,0 +1,15 @@
+package storagetest
+
+import (
+	"testing"
+
+	"github.com/yogenyslav/pkg/storage"
+)
+
+func TestPostgresContract(t *testing.T) {
+	pg := NewPostgres(t)
+
+	RunSQLDatabase(t, func(*testing.T) storage.SQLDatabase {
+		return pg
+	})
+}
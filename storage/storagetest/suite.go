@@ -0,0 +1,333 @@
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/yogenyslav/pkg/storage"
+	"github.com/yogenyslav/pkg/storage/postgres"
+)
+
+// Expecter is implemented by fakes that have to be told results of queries made by the contract suite.
+type Expecter interface {
+	ExpectQuery(query string) *Expectation
+	ExpectExec(query string) *Expectation
+}
+
+// RunSQLDatabase runs the storage.SQLDatabase contract suite against databases created by newDB for every subtest,
+// e.g. a Postgres connected to a local server or a FakeSQL, so they are verified to behave identically.
+// Databases implementing Expecter are told the results of the few queries the suite makes.
+func RunSQLDatabase(t *testing.T, newDB func(t *testing.T) storage.SQLDatabase) {
+	t.Helper()
+
+	subtests := []struct {
+		name string
+		test func(t *testing.T, db storage.SQLDatabase)
+	}{
+		{"GetTxWithoutTx", testGetTxWithoutTx},
+		{"TxMethodsWithoutTx", testTxMethodsWithoutTx},
+		{"BeginStoresTxInContext", testBeginStoresTx},
+		{"CommitClosesTx", testCommitClosesTx},
+		{"RollbackAfterCommit", testRollbackAfterCommit},
+		{"NestedBeginCreatesSavepoint", testNestedBegin},
+		{"WithTxCommits", testWithTxCommits},
+		{"WithTxRollsBackOnError", testWithTxRollsBackOnError},
+		{"WithTxRollsBackOnPanic", testWithTxRollsBackOnPanic},
+		{"WithTxRetriesSerializationFailure", testWithTxRetries},
+		{"WithTxDoesNotRetryNested", testWithTxNoNestedRetries},
+		{"QueryAndExec", testQueryAndExec},
+		{"QueryRows", testQueryRows},
+	}
+
+	for _, st := range subtests {
+		t.Run(st.name, func(t *testing.T) {
+			db := newDB(t)
+			st.test(t, db)
+		})
+	}
+}
+
+func testGetTxWithoutTx(t *testing.T, db storage.SQLDatabase) {
+	if _, err := db.GetTx(t.Context()); !errors.Is(err, postgres.ErrNoTxFound) {
+		t.Fatalf("GetTx without tx: got error %v, want %v", err, postgres.ErrNoTxFound)
+	}
+}
+
+func testTxMethodsWithoutTx(t *testing.T, db storage.SQLDatabase) {
+	ctx := t.Context()
+
+	var n int
+	if err := db.QueryTx(ctx, &n, "select 1"); !errors.Is(err, postgres.ErrNoTxFound) {
+		t.Errorf("QueryTx without tx: got error %v, want %v", err, postgres.ErrNoTxFound)
+	}
+	var ns []int
+	if err := db.QuerySliceTx(ctx, &ns, "select 1"); !errors.Is(err, postgres.ErrNoTxFound) {
+		t.Errorf("QuerySliceTx without tx: got error %v, want %v", err, postgres.ErrNoTxFound)
+	}
+	if _, err := db.ExecTx(ctx, "select 1"); !errors.Is(err, postgres.ErrNoTxFound) {
+		t.Errorf("ExecTx without tx: got error %v, want %v", err, postgres.ErrNoTxFound)
+	}
+	if err := db.CommitTx(ctx); !errors.Is(err, postgres.ErrNoTxFound) {
+		t.Errorf("CommitTx without tx: got error %v, want %v", err, postgres.ErrNoTxFound)
+	}
+	if err := db.RollbackTx(ctx); !errors.Is(err, postgres.ErrNoTxFound) {
+		t.Errorf("RollbackTx without tx: got error %v, want %v", err, postgres.ErrNoTxFound)
+	}
+}
+
+func testBeginStoresTx(t *testing.T, db storage.SQLDatabase) {
+	ctx := t.Context()
+
+	txCtx, err := db.BeginSerializable(ctx)
+	if err != nil {
+		t.Fatalf("BeginSerializable: %v", err)
+	}
+	defer rollback(txCtx, t, db)
+
+	if _, err = db.GetTx(txCtx); err != nil {
+		t.Errorf("GetTx in tx: %v", err)
+	}
+	if _, err = db.GetTx(ctx); !errors.Is(err, postgres.ErrNoTxFound) {
+		t.Errorf("GetTx with parent context: got error %v, want %v", err, postgres.ErrNoTxFound)
+	}
+}
+
+func testCommitClosesTx(t *testing.T, db storage.SQLDatabase) {
+	txCtx, err := db.Begin(t.Context(), storage.TxOptions{})
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+
+	if err = db.CommitTx(txCtx); err != nil {
+		t.Fatalf("CommitTx: %v", err)
+	}
+	if err = db.CommitTx(txCtx); !errors.Is(err, pgx.ErrTxClosed) {
+		t.Errorf("second CommitTx: got error %v, want %v", err, pgx.ErrTxClosed)
+	}
+	if _, err = db.ExecTx(txCtx, "select 1"); !errors.Is(err, pgx.ErrTxClosed) {
+		t.Errorf("ExecTx after commit: got error %v, want %v", err, pgx.ErrTxClosed)
+	}
+}
+
+func testRollbackAfterCommit(t *testing.T, db storage.SQLDatabase) {
+	txCtx, err := db.Begin(t.Context(), storage.TxOptions{})
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+
+	if err = db.CommitTx(txCtx); err != nil {
+		t.Fatalf("CommitTx: %v", err)
+	}
+	if err = db.RollbackTx(txCtx); err != nil {
+		t.Errorf("RollbackTx after commit: %v", err)
+	}
+}
+
+func testNestedBegin(t *testing.T, db storage.SQLDatabase) {
+	txCtx, err := db.Begin(t.Context(), storage.TxOptions{})
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	defer rollback(txCtx, t, db)
+
+	outer, err := db.GetTx(txCtx)
+	if err != nil {
+		t.Fatalf("GetTx: %v", err)
+	}
+
+	spCtx, err := db.Begin(txCtx, storage.TxOptions{})
+	if err != nil {
+		t.Fatalf("nested Begin: %v", err)
+	}
+	inner, err := db.GetTx(spCtx)
+	if err != nil {
+		t.Fatalf("GetTx in savepoint: %v", err)
+	}
+	if inner == outer {
+		t.Errorf("nested Begin returned the outer tx instead of a savepoint")
+	}
+
+	if err = db.RollbackTx(spCtx); err != nil {
+		t.Fatalf("RollbackTx of savepoint: %v", err)
+	}
+	if err = db.CommitTx(txCtx); err != nil {
+		t.Errorf("CommitTx after savepoint rollback: %v", err)
+	}
+}
+
+func testWithTxCommits(t *testing.T, db storage.SQLDatabase) {
+	var fnCtx context.Context
+	err := db.WithTx(t.Context(), storage.TxOptions{}, func(ctx context.Context) error {
+		fnCtx = ctx
+		_, err := db.GetTx(ctx)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+
+	if err = db.CommitTx(fnCtx); !errors.Is(err, pgx.ErrTxClosed) {
+		t.Errorf("CommitTx after WithTx: got error %v, want %v", err, pgx.ErrTxClosed)
+	}
+}
+
+// errContract is returned from transactions rolled back by the suite.
+var errContract = errors.New("rolled back by contract suite")
+
+func testWithTxRollsBackOnError(t *testing.T, db storage.SQLDatabase) {
+	var fnCtx context.Context
+	err := db.WithTx(t.Context(), storage.TxOptions{MaxRetries: 3}, func(ctx context.Context) error {
+		fnCtx = ctx
+		return errContract
+	})
+	if !errors.Is(err, errContract) {
+		t.Fatalf("WithTx: got error %v, want %v", err, errContract)
+	}
+
+	if err = db.CommitTx(fnCtx); !errors.Is(err, pgx.ErrTxClosed) {
+		t.Errorf("CommitTx after failed WithTx: got error %v, want %v", err, pgx.ErrTxClosed)
+	}
+}
+
+func testWithTxRollsBackOnPanic(t *testing.T, db storage.SQLDatabase) {
+	var fnCtx context.Context
+	func() {
+		defer func() {
+			if p := recover(); p == nil {
+				t.Errorf("WithTx didn't propagate panic")
+			}
+		}()
+
+		_ = db.WithTx(t.Context(), storage.TxOptions{}, func(ctx context.Context) error {
+			fnCtx = ctx
+			panic(errContract)
+		})
+	}()
+
+	if fnCtx == nil {
+		t.Fatalf("WithTx didn't call fn")
+	}
+	if err := db.CommitTx(fnCtx); !errors.Is(err, pgx.ErrTxClosed) {
+		t.Errorf("CommitTx after WithTx panic: got error %v, want %v", err, pgx.ErrTxClosed)
+	}
+}
+
+func testWithTxRetries(t *testing.T, db storage.SQLDatabase) {
+	var attempts int
+	err := db.WithTx(t.Context(), storage.TxOptions{MaxRetries: 2}, func(context.Context) error {
+		attempts++
+		if attempts < 3 {
+			return postgres.ErrSerializationFailure
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WithTx: %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("WithTx made %d attempts, want 3", attempts)
+	}
+}
+
+func testWithTxNoNestedRetries(t *testing.T, db storage.SQLDatabase) {
+	txCtx, err := db.Begin(t.Context(), storage.TxOptions{})
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	defer rollback(txCtx, t, db)
+
+	var attempts int
+	err = db.WithTx(txCtx, storage.TxOptions{MaxRetries: 2}, func(context.Context) error {
+		attempts++
+		return postgres.ErrSerializationFailure
+	})
+	if !errors.Is(err, postgres.ErrSerializationFailure) {
+		t.Fatalf("nested WithTx: got error %v, want %v", err, postgres.ErrSerializationFailure)
+	}
+	if attempts != 1 {
+		t.Errorf("nested WithTx made %d attempts, want 1", attempts)
+	}
+}
+
+func testQueryAndExec(t *testing.T, db storage.SQLDatabase) {
+	const (
+		query = "select 1 as n"
+		exec  = "select 1"
+	)
+
+	if e, ok := db.(Expecter); ok {
+		// expectations are matched in order
+		e.ExpectQuery(query).WillReturn(1)
+		e.ExpectQuery(query).WillReturn([]int{1})
+		e.ExpectQuery(query).WillReturn(1)
+		e.ExpectExec(exec).WillReturnRowsAffected(1).Times(2)
+	}
+
+	ctx := t.Context()
+
+	var n int
+	if err := db.Query(ctx, &n, query); err != nil || n != 1 {
+		t.Errorf("Query: got %d, %v, want 1", n, err)
+	}
+	var ns []int
+	if err := db.QuerySlice(ctx, &ns, query); err != nil || len(ns) != 1 || ns[0] != 1 {
+		t.Errorf("QuerySlice: got %v, %v, want [1]", ns, err)
+	}
+	if rows, err := db.Exec(ctx, exec); err != nil || rows != 1 {
+		t.Errorf("Exec: got %d, %v, want 1", rows, err)
+	}
+
+	err := db.WithTx(ctx, storage.TxOptions{}, func(ctx context.Context) error {
+		var n int
+		if err := db.QueryTx(ctx, &n, query); err != nil || n != 1 {
+			t.Errorf("QueryTx: got %d, %v, want 1", n, err)
+		}
+		if rows, err := db.ExecTx(ctx, exec); err != nil || rows != 1 {
+			t.Errorf("ExecTx: got %d, %v, want 1", rows, err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("WithTx: %v", err)
+	}
+}
+
+func testQueryRows(t *testing.T, db storage.SQLDatabase) {
+	const query = "select n from generate_series(1, 3) as n"
+
+	if e, ok := db.(Expecter); ok {
+		e.ExpectQuery(query).WillReturn([]int{1, 2, 3})
+	}
+
+	rows, err := db.QueryRows(t.Context(), query)
+	if err != nil {
+		t.Fatalf("QueryRows: %v", err)
+	}
+	defer rows.Close()
+
+	var ns []int
+	for rows.Next() {
+		var n int
+		if err = rows.Scan(&n); err != nil {
+			t.Fatalf("Scan: %v", err)
+		}
+		ns = append(ns, n)
+	}
+	if err = rows.Err(); err != nil {
+		t.Errorf("Err: %v", err)
+	}
+	if len(ns) != 3 || ns[0] != 1 || ns[2] != 3 {
+		t.Errorf("QueryRows: got %v, want [1 2 3]", ns)
+	}
+}
+
+// rollback rolls back the tx from ctx if the test didn't finish it.
+func rollback(ctx context.Context, t *testing.T, db storage.SQLDatabase) {
+	t.Helper()
+
+	if err := db.RollbackTx(context.WithoutCancel(ctx)); err != nil {
+		t.Errorf("RollbackTx: %v", err)
+	}
+}